@@ -24,7 +24,7 @@ func main() {
 
 	dbQueries := database.New(db)
 
-	appState := cli.State{Cfg: &cfg, Db: dbQueries}
+	appState := cli.State{Cfg: &cfg, Db: dbQueries, Conn: db}
 
 	cmds := cli.Commands{
 		ValidCommands: make(map[string]func(*cli.State, cli.Command) error),
@@ -49,11 +49,24 @@ func registerCmds(cmds *cli.Commands) {
 	cmds.Register("register", cli.HandlerRegister)
 	cmds.Register("reset", cli.HandlerReset)
 	cmds.Register("users", cli.HandlerUsers)
+	cmds.Register("migrate", cli.HandlerMigrate)
 	cmds.Register("agg", cli.HandlerAgg)
 	cmds.Register("addfeed", cli.MiddlewareLoggedIn(cli.HandlerAddFeed))
 	cmds.Register("feeds", cli.HandlerFeeds)
+	cmds.Register("enablefeed", cli.HandlerEnableFeed)
+	cmds.Register("setinterval", cli.HandlerSetInterval)
+	cmds.Register("setretention", cli.HandlerSetRetention)
+	cmds.Register("prune", cli.HandlerPrune)
 	cmds.Register("follow", cli.MiddlewareLoggedIn(cli.HandlerFollow))
 	cmds.Register("following", cli.MiddlewareLoggedIn(cli.HandlerFollowing))
 	cmds.Register("unfollow", cli.MiddlewareLoggedIn(cli.HandlerUnfollow))
 	cmds.Register("browse", cli.MiddlewareLoggedIn(cli.HandlerBrowse))
+	cmds.Register("read", cli.MiddlewareLoggedIn(cli.HandlerRead))
+	cmds.Register("mark-read", cli.MiddlewareLoggedIn(cli.HandlerMarkRead))
+	cmds.Register("star", cli.MiddlewareLoggedIn(cli.HandlerStar))
+	cmds.Register("unstar", cli.MiddlewareLoggedIn(cli.HandlerUnstar))
+	cmds.Register("saved", cli.MiddlewareLoggedIn(cli.HandlerSaved))
+	cmds.Register("later", cli.MiddlewareLoggedIn(cli.HandlerLater))
+	cmds.Register("search", cli.MiddlewareLoggedIn(cli.HandlerSearch))
+	cmds.Register("tui", cli.MiddlewareLoggedIn(cli.HandlerTUI))
 }
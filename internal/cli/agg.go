@@ -0,0 +1,625 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/eleinah/gator/internal/htmltext"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultRetryAfter is used when a host asks us to slow down without
+	// saying for how long.
+	defaultRetryAfter = 10 * time.Minute
+	maxRetryAfter     = 24 * time.Hour
+	// claimLease is how long a claimed feed stays reserved for this process.
+	// The lease is renewed when a worker starts on the feed, so it only has
+	// to cover one fetch rather than the whole batch. If the process dies
+	// mid-fetch, other aggregators pick the feed up once the lease runs out.
+	claimLease = 5 * time.Minute
+	// pruneInterval is how often the aggregator enforces post retention.
+	pruneInterval = time.Hour
+)
+
+type aggregator struct {
+	// instance identifies this process in feed claims, so any number of
+	// aggregators can share one database without fetching the same feed.
+	instance    string
+	s           *State
+	fetcher     *fetcher
+	hosts       *hostLimiter
+	slots       *hostSlots
+	concurrency int
+	batchSize   int
+	// defaultInterval is how often feeds are refreshed when neither the
+	// user nor the feed itself says otherwise.
+	defaultInterval time.Duration
+	// attempted holds the feeds already fetched in --once mode, so a feed
+	// that falls due again during the run isn't fetched twice.
+	attempted map[uuid.UUID]bool
+	lastPrune time.Time
+}
+
+func HandlerAgg(s *State, cmd Command) error {
+	usage := fmt.Errorf("usage: %s <request_wait_time> | --once [--concurrency <n>] [--per-host <n>] [--batch <n>] [--host-interval <duration>] [--default-interval <duration>]\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	once := fs.Bool("once", false, "fetch every due feed a single time and exit")
+	concurrency := fs.Int("concurrency", 4, "number of feeds fetched at once")
+	perHost := fs.Int("per-host", 1, "number of feeds fetched at once from the same host, each at most once per --host-interval")
+	batchSize := fs.Int("batch", 0, "number of due feeds claimed per tick, defaults to 4x concurrency")
+	hostInterval := fs.Duration("host-interval", time.Minute, "minimum time between requests in each of a host's --per-host slots")
+	defaultInterval := fs.Duration("default-interval", time.Hour, "refresh interval for feeds that don't specify one")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil {
+		return usage
+	}
+	if *once && len(args) != 0 || !*once && len(args) != 1 {
+		return usage
+	}
+
+	if *concurrency < 1 || *perHost < 1 || *batchSize < 0 {
+		return fmt.Errorf("--concurrency and --per-host must be at least 1 and --batch can't be negative\n")
+	}
+	if *defaultInterval < time.Second {
+		return fmt.Errorf("--default-interval must be at least a second\n")
+	}
+	if *batchSize == 0 {
+		*batchSize = 4 * *concurrency
+	}
+
+	var waitTime time.Duration
+	if !*once {
+		waitTime, err = time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid duration given: %w\n", err)
+		}
+	}
+
+	agg := &aggregator{
+		instance:        newInstanceID(),
+		s:               s,
+		fetcher:         newFetcher(),
+		hosts:           newHostLimiter(*hostInterval, *perHost),
+		slots:           newHostSlots(*perHost),
+		concurrency:     *concurrency,
+		batchSize:       *batchSize,
+		defaultInterval: *defaultInterval,
+	}
+
+	// The first SIGINT or SIGTERM stops new fetches from starting and lets
+	// the ones in flight finish storing their posts. A second one kills the
+	// process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if *once {
+		return agg.runOnce(ctx)
+	}
+
+	log.Printf("...checking for due feeds every %s with %d workers...", waitTime, *concurrency)
+
+	ticker := time.NewTicker(waitTime)
+	defer ticker.Stop()
+
+	for {
+		agg.scrapeFeeds(ctx)
+		agg.prune()
+
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce fetches every feed that is due, each a single time, and returns an
+// error if any of them failed. Feeds on hosts that are cooling down are waited
+// for rather than skipped.
+func (a *aggregator) runOnce(ctx context.Context) error {
+	a.attempted = make(map[uuid.UUID]bool)
+
+	fetched, failed := 0, 0
+	for ctx.Err() == nil {
+		result := a.scrapeFeeds(ctx)
+		fetched += result.fetched
+		failed += result.failed
+		if result.claimed == 0 {
+			break
+		}
+
+		// Everything claimed was either fetched earlier in this run or is
+		// waiting on a host. Only the latter is worth waiting for.
+		if result.fetched == 0 {
+			if result.retryAt.IsZero() {
+				break
+			}
+			// Deferred feeds fall due by the database's clock a moment
+			// after retryAt, see DeferFeedClaims.
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(result.retryAt) + time.Second):
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		log.Println("interrupted, not every due feed was fetched")
+	} else {
+		a.prune()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed to fetch\n", failed, fetched)
+	}
+	return nil
+}
+
+// prune removes posts that fall outside their feed's retention policy, at
+// most once per pruneInterval.
+func (a *aggregator) prune() {
+	if time.Since(a.lastPrune) < pruneInterval {
+		return
+	}
+	a.lastPrune = time.Now()
+
+	pruned, err := prunePosts(a.s, false)
+	if err != nil {
+		log.Printf("couldn't prune posts: %v", err)
+		return
+	}
+
+	total := 0
+	for _, count := range pruned {
+		total += count
+	}
+	if total > 0 {
+		log.Printf("pruned %d posts past their feed's retention", total)
+	}
+}
+
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
+
+type scrapeResult struct {
+	claimed int
+	fetched int
+	failed  int
+	// retryAt is when the earliest host that had feeds skipped cools down.
+	retryAt time.Time
+}
+
+// scrapeFeeds claims a batch of the most overdue feeds and fetches them with
+// a pool of workers. Feeds whose host is cooling down are released and put
+// off until the host is ready, and the rest of the batch is released as is
+// once ctx is cancelled.
+func (a *aggregator) scrapeFeeds(ctx context.Context) scrapeResult {
+	var result scrapeResult
+
+	feeds, err := a.s.Db.ClaimFeedsToFetch(context.Background(), database.ClaimFeedsToFetchParams{
+		ClaimedBy: sql.NullString{
+			String: a.instance,
+			Valid:  true,
+		},
+		LeaseSeconds: int32(claimLease / time.Second),
+		BatchSize:    int32(a.batchSize),
+	})
+	if err != nil {
+		log.Printf("couldn't get feeds to fetch: %v\n", err)
+		return result
+	}
+
+	if len(feeds) == 0 {
+		log.Println("no feeds due for fetching")
+		return result
+	}
+	result.claimed = len(feeds)
+
+	var mu sync.Mutex
+	lost := 0
+	jobs := make(chan database.Feed)
+	var wg sync.WaitGroup
+	for range a.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				release := a.slots.acquire(feedHost(feed.Url))
+				if !a.renewClaim(feed) {
+					release()
+					mu.Lock()
+					lost++
+					mu.Unlock()
+					continue
+				}
+				err := a.scrapeFeed(feed)
+				release()
+
+				if err != nil {
+					log.Println(err)
+					mu.Lock()
+					result.failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	now := time.Now()
+	var skipped []uuid.UUID
+	// deferred holds the skipped feeds whose host is cooling down, by when
+	// the host is ready again.
+	deferred := make(map[uuid.UUID]time.Time)
+	for _, feed := range feeds {
+		if ctx.Err() != nil || a.attempted[feed.ID] {
+			skipped = append(skipped, feed.ID)
+			continue
+		}
+		host := feedHost(feed.Url)
+		if !a.hosts.reserve(host, now) {
+			readyAt := a.hosts.readyAt(host)
+			deferred[feed.ID] = readyAt
+			if result.retryAt.IsZero() || readyAt.Before(result.retryAt) {
+				result.retryAt = readyAt
+			}
+			continue
+		}
+		if a.attempted != nil {
+			a.attempted[feed.ID] = true
+		}
+		result.fetched++
+		jobs <- feed
+	}
+	close(jobs)
+
+	claimedBy := sql.NullString{
+		String: a.instance,
+		Valid:  true,
+	}
+	if len(skipped) > 0 {
+		err := a.s.Db.ReleaseFeedClaims(context.Background(), database.ReleaseFeedClaimsParams{
+			Ids:       skipped,
+			ClaimedBy: claimedBy,
+		})
+		if err != nil {
+			log.Printf("couldn't release skipped feeds: %v", err)
+		}
+	}
+	if len(deferred) > 0 {
+		params := database.DeferFeedClaimsParams{
+			ClaimedBy: claimedBy,
+		}
+		for id, readyAt := range deferred {
+			params.Ids = append(params.Ids, id)
+			params.DelaysMs = append(params.DelaysMs, int32(max(time.Until(readyAt), 0)/time.Millisecond))
+		}
+		if err := a.s.Db.DeferFeedClaims(context.Background(), params); err != nil {
+			log.Printf("couldn't defer feeds waiting on their host: %v", err)
+		}
+	}
+
+	wg.Wait()
+	result.fetched -= lost
+
+	log.Printf("fetched %d of %d due feeds, %d failed, %d skipped, %d waiting on their host, %d taken by another aggregator", result.fetched, len(feeds), result.failed, len(skipped), len(deferred), lost)
+
+	return result
+}
+
+// renewClaim extends the claim on a feed right before fetching it. Feeds can
+// wait behind the rest of the batch for longer than the lease, and one whose
+// claim lapsed and was taken by another aggregator is left to that one.
+func (a *aggregator) renewClaim(feed database.Feed) bool {
+	renewed, err := a.s.Db.RenewFeedClaim(context.Background(), database.RenewFeedClaimParams{
+		LeaseSeconds: int32(claimLease / time.Second),
+		ID:           feed.ID,
+		ClaimedBy: sql.NullString{
+			String: a.instance,
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		log.Printf("couldn't renew claim on feed '%s': %v", feed.Name, err)
+		return false
+	}
+	return renewed > 0
+}
+
+// scrapeFeed fetches a feed and stores its posts. It deliberately doesn't
+// take the aggregator's context: once a fetch has started it is allowed to
+// finish, so shutting down never leaves a feed half stored.
+func (a *aggregator) scrapeFeed(feed database.Feed) error {
+	db := a.s.Db
+
+	response, err := a.fetcher.fetchFeed(context.Background(), feed)
+	if err != nil {
+		a.recordFailure(feed, err)
+		a.handleThrottling(feed, err)
+		a.handleGone(feed, err)
+		return fmt.Errorf("couldn't fetch feed '%s': %w", feed.Name, err)
+	}
+
+	autoInterval := sql.NullInt32{}
+	if !response.NotModified {
+		if interval, ok := refreshInterval(response.Feed, time.Now().UTC()); ok {
+			autoInterval = sql.NullInt32{
+				Int32: int32(interval / time.Second),
+				Valid: true,
+			}
+		}
+	}
+
+	fetched := database.MarkFeedFetchedParams{
+		ID:                     feed.ID,
+		AutoIntervalSeconds:    autoInterval,
+		DefaultIntervalSeconds: int32(a.defaultInterval / time.Second),
+	}
+
+	if response.NotModified {
+		if err := db.MarkFeedFetched(context.Background(), fetched); err != nil {
+			return fmt.Errorf("couldn't mark feed '%s' as fetched: %w", feed.Name, err)
+		}
+		a.moveIfRedirected(feed, response)
+		log.Printf("feed '%s' not modified since last fetch", feed.Name)
+		return nil
+	}
+
+	// The feed only counts as fetched once its posts are stored, a feed
+	// whose posts can't be stored is as broken as one that can't be fetched.
+	newPosts, updatedPosts, err := a.storePosts(feed, response, fetched)
+	a.moveIfRedirected(feed, response)
+	if err != nil {
+		a.recordFailure(feed, fmt.Errorf("couldn't store posts: %w", err))
+		return fmt.Errorf("couldn't store posts for feed '%s': %w", feed.Name, err)
+	}
+
+	log.Printf("feed '%s' collected, %v posts found, %v new, %v updated", feed.Name, len(response.Feed.Channel.Item), newPosts, updatedPosts)
+	return nil
+}
+
+// storePosts saves a fetched feed's items in a single transaction, along with
+// the cache validators for the next fetch and the feed's new schedule. Either
+// every item is stored or none are, so a failure is simply retried in full on
+// the next fetch instead of a 304 hiding the items that didn't make it.
+func (a *aggregator) storePosts(feed database.Feed, response *feedResponse, fetched database.MarkFeedFetchedParams) (newPosts, updatedPosts int, err error) {
+	fetchedFeed := response.Feed
+	fetchedAt := time.Now().UTC()
+
+	// Items are keyed by guid, and a feed repeating one would make the bulk
+	// upsert touch the same row twice. The last copy wins, as it would if
+	// the items were stored one at a time.
+	params := database.UpsertPostsParams{
+		FetchedAt: fetchedAt,
+		FeedID:    feed.ID,
+	}
+	index := make(map[string]int)
+	for _, item := range fetchedFeed.Channel.Item {
+		guid := item.identity()
+		if guid == "" {
+			log.Printf("skipping item '%s' in feed '%s': no guid or link", item.Title, feed.Name)
+			continue
+		}
+
+		publishedAt, source := publicationDate(item.PubDate, fetchedFeed.date(), fetchedAt)
+
+		i, ok := index[guid]
+		if !ok {
+			i = len(params.Guids)
+			index[guid] = i
+			params.Titles = append(params.Titles, "")
+			params.Urls = append(params.Urls, "")
+			params.Descriptions = append(params.Descriptions, "")
+			params.PublishedAts = append(params.PublishedAts, time.Time{})
+			params.PublishedAtSources = append(params.PublishedAtSources, "")
+			params.Guids = append(params.Guids, guid)
+			params.ContentHashes = append(params.ContentHashes, "")
+			params.DescriptionTexts = append(params.DescriptionTexts, "")
+		}
+		params.Titles[i] = item.Title
+		params.Urls[i] = item.Link
+		params.Descriptions[i] = item.Description
+		params.PublishedAts[i] = publishedAt
+		params.PublishedAtSources[i] = string(source)
+		params.ContentHashes[i] = item.contentHash()
+		params.DescriptionTexts[i] = htmltext.PlainText(item.Description)
+	}
+
+	ctx := context.Background()
+	tx, err := a.s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	db := a.s.Db.WithTx(tx)
+
+	if len(params.Guids) > 0 {
+		_, err := db.AdoptLegacyPosts(ctx, database.AdoptLegacyPostsParams{
+			Urls:   params.Urls,
+			Guids:  params.Guids,
+			FeedID: feed.ID,
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("couldn't match posts stored before guids: %w", err)
+		}
+
+		if a.s.Cfg.PostHistory {
+			_, err := db.CreatePostRevisions(ctx, database.CreatePostRevisionsParams{
+				CreatedAt:     fetchedAt,
+				Guids:         params.Guids,
+				ContentHashes: params.ContentHashes,
+				FeedID:        feed.ID,
+			})
+			if err != nil {
+				return 0, 0, fmt.Errorf("couldn't record post revisions: %w", err)
+			}
+		}
+
+		// Only new and changed posts come back, unchanged ones are left alone.
+		stored, err := db.UpsertPosts(ctx, params)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, post := range stored {
+			if post.Inserted {
+				newPosts++
+			} else {
+				updatedPosts++
+			}
+		}
+	}
+
+	// Postgres only delivers the notification once the transaction commits,
+	// so listeners never see posts that end up rolled back.
+	if newPosts > 0 {
+		if err := db.NotifyNewPosts(ctx, feed.ID); err != nil {
+			return 0, 0, fmt.Errorf("couldn't notify about new posts: %w", err)
+		}
+	}
+
+	// Pruned posts that dropped out of the feed can't come back through
+	// it, so there is no need to keep skipping them.
+	err = db.ForgetPrunedPosts(ctx, database.ForgetPrunedPostsParams{
+		FeedID: feed.ID,
+		Guids:  params.Guids,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't forget pruned posts: %w", err)
+	}
+
+	err = db.UpdateFeedCacheHeaders(ctx, database.UpdateFeedCacheHeadersParams{
+		ID: feed.ID,
+		Etag: sql.NullString{
+			String: response.ETag,
+			Valid:  response.ETag != "",
+		},
+		LastModified: sql.NullString{
+			String: response.LastModified,
+			Valid:  response.LastModified != "",
+		},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't store cache headers: %w", err)
+	}
+
+	if err := db.MarkFeedFetched(ctx, fetched); err != nil {
+		return 0, 0, fmt.Errorf("couldn't mark feed as fetched: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return newPosts, updatedPosts, nil
+}
+
+// recordFailure stores a failed fetch on the feed. Consecutive failures push
+// the feed's next fetch back exponentially, see MarkFeedFetchFailed.
+func (a *aggregator) recordFailure(feed database.Feed, err error) {
+	err = a.s.Db.MarkFeedFetchFailed(context.Background(), database.MarkFeedFetchFailedParams{
+		ID: feed.ID,
+		LastError: sql.NullString{
+			String: err.Error(),
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		log.Printf("couldn't record failure for feed '%s': %v", feed.Name, err)
+	}
+}
+
+// handleThrottling backs off from a feed's host after a 429 or 503, for as
+// long as the server's Retry-After asked. The delay is stored on the feed so
+// it survives restarts of the aggregator.
+func (a *aggregator) handleThrottling(feed database.Feed, err error) {
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.Kind != FetchErrHTTPStatus {
+		return
+	}
+	if fetchErr.StatusCode != http.StatusTooManyRequests && fetchErr.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	retryAfter := fetchErr.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	retryAfter = min(retryAfter, maxRetryAfter)
+
+	a.hosts.backoff(feedHost(feed.Url), time.Now().Add(retryAfter))
+
+	err = a.s.Db.SetFeedRetryAfter(context.Background(), database.SetFeedRetryAfterParams{
+		ID:                feed.ID,
+		RetryAfterSeconds: int32(retryAfter / time.Second),
+	})
+	if err != nil {
+		log.Printf("couldn't store retry delay for feed '%s': %v", feed.Name, err)
+		return
+	}
+
+	log.Printf("host for feed '%s' asked to back off, retrying in %s", feed.Name, retryAfter)
+}
+
+// handleGone disables a feed whose server says it's gone for good, so it
+// stops being scheduled. It can be re-enabled with the enablefeed command.
+func (a *aggregator) handleGone(feed database.Feed, err error) {
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.Kind != FetchErrHTTPStatus || fetchErr.StatusCode != http.StatusGone {
+		return
+	}
+
+	err = a.s.Db.DisableFeed(context.Background(), database.DisableFeedParams{
+		ID: feed.ID,
+		DisabledReason: sql.NullString{
+			String: "410 Gone",
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		log.Printf("couldn't disable feed '%s': %v", feed.Name, err)
+		return
+	}
+
+	log.Printf("feed '%s' is gone, disabled it", feed.Name)
+}
+
+// moveIfRedirected follows a permanent redirect seen while fetching a feed.
+func (a *aggregator) moveIfRedirected(feed database.Feed, response *feedResponse) {
+	if response.PermanentURL != "" && response.PermanentURL != feed.Url {
+		a.moveFeed(feed, response.PermanentURL)
+	}
+}
+
+// moveFeed points a feed at the URL it permanently redirects to. The old URL
+// is kept in the feed's history so commands given it still find the feed.
+func (a *aggregator) moveFeed(feed database.Feed, newURL string) {
+	err := a.s.Db.UpdateFeedURL(context.Background(), database.UpdateFeedURLParams{
+		ID:  feed.ID,
+		Url: newURL,
+	})
+	if err != nil {
+		log.Printf("couldn't move feed '%s' to '%s': %v", feed.Name, newURL, err)
+		return
+	}
+
+	log.Printf("feed '%s' moved permanently from '%s' to '%s'", feed.Name, feed.Url, newURL)
+}
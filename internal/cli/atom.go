@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type AtomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Title    AtomText    `xml:"title"`
+	Subtitle AtomText    `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Link     []AtomLink  `xml:"link"`
+	Entry    []AtomEntry `xml:"entry"`
+
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+type AtomEntry struct {
+	ID        string     `xml:"id"`
+	Title     AtomText   `xml:"title"`
+	Link      []AtomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Summary   AtomText   `xml:"summary"`
+	Content   AtomText   `xml:"content"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// AtomText is an Atom text construct. Plain text and escaped html arrive as
+// character data, while xhtml content is kept as raw inner markup.
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		// xhtml content is wrapped in a div that isn't part of it, see
+		// RFC 4287 section 3.1.1.3.
+		var wrapper struct {
+			Inner string `xml:",innerxml"`
+		}
+		if err := xml.Unmarshal([]byte(t.Inner), &wrapper); err == nil {
+			return strings.TrimSpace(wrapper.Inner)
+		}
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// alternateLink picks the link an entry or feed points readers to: an
+// html rel="alternate" link if there is one, otherwise any alternate link.
+func alternateLink(links []AtomLink) string {
+	var fallback string
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if fallback == "" {
+			fallback = link.Href
+		}
+	}
+	return fallback
+}
+
+func (f *AtomFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = f.Title.String()
+	feed.Channel.Link = alternateLink(f.Link)
+	feed.Channel.Description = f.Subtitle.String()
+	feed.Channel.LastBuildDate = f.Updated
+	feed.Channel.UpdatePeriod = f.UpdatePeriod
+	feed.Channel.UpdateFrequency = f.UpdateFrequency
+
+	for _, entry := range f.Entry {
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        entry.ID,
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Link),
+			Description: description,
+			PubDate:     pubDate,
+		})
+	}
+
+	return &feed
+}
@@ -19,6 +19,12 @@ func (c *Commands) Run(s *State, cmd Command) error {
 		return errors.New("Command does not exist")
 	}
 
+	args, err := globalOptions(s, cmd.Args)
+	if err != nil {
+		return err
+	}
+	cmd.Args = args
+
 	return f(s, cmd)
 }
 
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dateSource records where a post's published_at came from.
+type dateSource string
+
+const (
+	dateSourceItem  dateSource = "item"
+	dateSourceFeed  dateSource = "feed"
+	dateSourceFetch dateSource = "fetch"
+)
+
+var feedDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04-07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04 -0700",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 2006 15:04",
+	"Jan 2 15:04:05 2006",
+	"Jan 2 15:04:05 -0700 2006",
+	"Jan 2 15:04:05 MST 2006",
+	"Jan 2 2006",
+	"January 2 2006",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+// Leading day names are dropped before parsing, so feeds that localize them
+// ("Mi, 02 Okt 2024", "Lun., 2 sept. 2024") or misspell them still parse. A
+// leading month name ("Oct 2 2024") matches the same pattern and is kept.
+var leadingDayName = regexp.MustCompile(`^\p{L}+\.?,?\s+`)
+
+var repeatedSpace = regexp.MustCompile(`\s+`)
+
+// Zone abbreviations seen in feeds. time.Parse only knows the offset of the
+// local zone's abbreviations and treats every other one as UTC.
+var zoneOffsets = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"BST":  "+0100",
+	"IST":  "+0530",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"MEZ":  "+0100",
+	"MESZ": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+// Month names in the languages that show up most often in our feeds, mapped
+// to the English abbreviations time.Parse understands.
+var monthNames = map[string]string{
+	"januar": "Jan", "februar": "Feb", "märz": "Mar", "mär": "Mar", "mai": "May",
+	"juni": "Jun", "juli": "Jul", "okt": "Oct", "oktober": "Oct", "dez": "Dec", "dezember": "Dec",
+	"janv": "Jan", "janvier": "Jan", "févr": "Feb", "février": "Feb", "mars": "Mar", "avr": "Apr",
+	"avril": "Apr", "juin": "Jun", "juil": "Jul", "juillet": "Jul", "août": "Aug", "sept": "Sep",
+	"septembre": "Sep", "octobre": "Oct", "novembre": "Nov", "déc": "Dec", "décembre": "Dec",
+	"ene": "Jan", "enero": "Jan", "febrero": "Feb", "marzo": "Mar", "abr": "Apr", "abril": "Apr",
+	"mayo": "May", "junio": "Jun", "julio": "Jul", "ago": "Aug", "agosto": "Aug", "septiembre": "Sep",
+	"setiembre": "Sep", "octubre": "Oct", "noviembre": "Nov", "dic": "Dec", "diciembre": "Dec",
+}
+
+// parseFeedDate parses a date in any of the formats commonly found in RSS,
+// Atom and JSON feeds. Dates are normalized first (day names and commas
+// dropped, months and zones translated), so the layouts above don't carry
+// them. The result is always in UTC.
+func parseFeedDate(value string) (time.Time, bool) {
+	value = normalizeFeedDate(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func normalizeFeedDate(value string) string {
+	value = strings.TrimSpace(repeatedSpace.ReplaceAllString(value, " "))
+	if value == "" {
+		return ""
+	}
+
+	// Day names only ever come before a day number or a month, never before
+	// an ISO date.
+	if value[0] < '0' || value[0] > '9' {
+		value = stripDayName(value)
+	}
+
+	fields := strings.Split(value, " ")
+	for i, field := range fields {
+		if month, ok := monthAbbrev(field); ok {
+			fields[i] = month
+			continue
+		}
+		if i > 0 {
+			if offset, ok := zoneOffsets[strings.ToUpper(field)]; ok {
+				fields[i] = offset
+			}
+		}
+	}
+	value = strings.Join(fields, " ")
+
+	return strings.ReplaceAll(value, ",", "")
+}
+
+// stripDayName drops a leading day name. Some abbreviations are both a day
+// and a month (Spanish "mar." for martes), so a leading month name is only
+// taken for a day name when another month follows it.
+func stripDayName(value string) string {
+	loc := leadingDayName.FindStringIndex(value)
+	if loc == nil {
+		return value
+	}
+	word, rest := value[:loc[1]], value[loc[1]:]
+	if rest == "" {
+		return value
+	}
+
+	restFields := strings.Fields(rest)
+	if isMonthName(word) && !slices.ContainsFunc(restFields, isMonthName) {
+		return value
+	}
+	if (rest[0] >= '0' && rest[0] <= '9') || isMonthName(restFields[0]) {
+		return rest
+	}
+	return value
+}
+
+// monthAbbrev returns the English abbreviation time.Parse understands for a
+// month name in English or one of the languages in monthNames.
+func monthAbbrev(word string) (string, bool) {
+	key := strings.ToLower(strings.TrimRight(strings.TrimSpace(word), ".,"))
+	if month, ok := monthNames[key]; ok {
+		return month, true
+	}
+	for month := time.January; month <= time.December; month++ {
+		name := strings.ToLower(month.String())
+		if key == name || key == name[:3] || key == "sept" && month == time.September {
+			return month.String()[:3], true
+		}
+	}
+	return "", false
+}
+
+func isMonthName(word string) bool {
+	_, ok := monthAbbrev(word)
+	return ok
+}
+
+// publicationDate resolves the date a post was published, falling back to
+// the feed-level date and then to the time the feed was fetched.
+func publicationDate(itemDate, feedDate string, fetchedAt time.Time) (time.Time, dateSource) {
+	if t, ok := parseFeedDate(itemDate); ok {
+		return t, dateSourceItem
+	}
+	if t, ok := parseFeedDate(feedDate); ok {
+		return t, dateSourceFeed
+	}
+	return fetchedAt.UTC(), dateSourceFetch
+}
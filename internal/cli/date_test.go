@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFeedDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Wed, 02 Oct 2002 13:00:00 GMT", time.Date(2002, 10, 2, 13, 0, 0, 0, time.UTC)},
+		{"Wed, 02 Oct 2002 15:00:00 +0200", time.Date(2002, 10, 2, 13, 0, 0, 0, time.UTC)},
+		{"Wed, 2 Oct 02 13:00 EST", time.Date(2002, 10, 2, 18, 0, 0, 0, time.UTC)},
+		{"2024-10-02T13:00:00Z", time.Date(2024, 10, 2, 13, 0, 0, 0, time.UTC)},
+		{"2024-10-02T15:00:00+02:00", time.Date(2024, 10, 2, 13, 0, 0, 0, time.UTC)},
+		{"2024-10-02 13:00:00", time.Date(2024, 10, 2, 13, 0, 0, 0, time.UTC)},
+		{"2024-10-02", time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{"Jan 2 2006", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"March 5, 2024", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"Mar 05 2024 10:00 GMT", time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)},
+		{"October 2, 2024", time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{"Oct 2 15:04:05 2024", time.Date(2024, 10, 2, 15, 4, 5, 0, time.UTC)},
+		{"Mon Jan 2 15:04:05 MST 2006", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"Mi, 02 Okt 2024 10:00:00 +0200", time.Date(2024, 10, 2, 8, 0, 0, 0, time.UTC)},
+		{"Lun., 2 sept. 2024", time.Date(2024, 9, 2, 0, 0, 0, 0, time.UTC)},
+		{"mar., 1 oct. 2024", time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"Mai 3 2024", time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"  Thu,  03   Oct 2024  08:00:00  GMT ", time.Date(2024, 10, 3, 8, 0, 0, 0, time.UTC)},
+		{"10/02/2024", time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseFeedDate(tt.value)
+		if !ok {
+			t.Errorf("parseFeedDate(%q) failed to parse", tt.value)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("parseFeedDate(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseFeedDateInvalid(t *testing.T) {
+	for _, value := range []string{"", "   ", "yesterday", "Monday", "Oct", "2024-13-45"} {
+		if got, ok := parseFeedDate(value); ok {
+			t.Errorf("parseFeedDate(%q) = %v, want failure", value, got)
+		}
+	}
+}
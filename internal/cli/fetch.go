@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	fetchConnectTimeout = 10 * time.Second
+	fetchHeaderTimeout  = 20 * time.Second
+	fetchTimeout        = 60 * time.Second
+	fetchMaxBodySize    = 10 << 20
+	fetchMaxRedirects   = 5
+)
+
+type FetchErrorKind string
+
+const (
+	FetchErrDNS        FetchErrorKind = "dns"
+	FetchErrTLS        FetchErrorKind = "tls"
+	FetchErrTimeout    FetchErrorKind = "timeout"
+	FetchErrConnection FetchErrorKind = "connection"
+	FetchErrRedirect   FetchErrorKind = "redirect"
+	FetchErrHTTPStatus FetchErrorKind = "http status"
+	FetchErrTooLarge   FetchErrorKind = "too large"
+	FetchErrParse      FetchErrorKind = "parse"
+)
+
+// FetchError is returned for every failed feed fetch, classifying what went
+// wrong so callers can decide how to react.
+type FetchError struct {
+	Kind       FetchErrorKind
+	URL        string
+	StatusCode int
+	// RetryAfter is how long the server asked us to wait before trying
+	// again, if the response carried a Retry-After header.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.Kind == FetchErrHTTPStatus {
+		return fmt.Sprintf("fetching %s: unexpected status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("fetching %s: %s error: %v", e.URL, e.Kind, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errBodyTooLarge     = errors.New("response body too large")
+)
+
+// fetcher is the HTTP client used for feeds. Unlike a bare http.Client it
+// bounds how long a request may take and how much it may download, so one
+// misbehaving host can't stall the aggregator.
+type fetcher struct {
+	client      *http.Client
+	maxBodySize int64
+}
+
+func newFetcher() *fetcher {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   fetchConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   fetchConnectTimeout,
+		ResponseHeaderTimeout: fetchHeaderTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   2,
+		// Decompression is done by the fetcher so the body limit also
+		// applies to the decompressed size.
+		DisableCompression: true,
+	}
+
+	return &fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   fetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= fetchMaxRedirects {
+					return errTooManyRedirects
+				}
+				return nil
+			},
+		},
+		maxBodySize: fetchMaxBodySize,
+	}
+}
+
+// get performs a GET request. Any error it returns is a *FetchError; the
+// caller must close the response body otherwise.
+func (f *fetcher) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchErrConnection, URL: url, Err: err}
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, &FetchError{Kind: classifyFetchError(err), URL: url, Err: err}
+	}
+
+	return res, nil
+}
+
+// readBody reads and decompresses a response body, refusing bodies larger
+// than the fetcher's limit either before or after decompression.
+func (f *fetcher) readBody(res *http.Response) ([]byte, error) {
+	url := res.Request.URL.String()
+
+	if res.ContentLength > f.maxBodySize {
+		return nil, &FetchError{Kind: FetchErrTooLarge, URL: url, Err: errBodyTooLarge}
+	}
+
+	var body io.Reader = &limitedReader{r: res.Body, n: f.maxBodySize}
+
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, &FetchError{Kind: FetchErrParse, URL: url, Err: err}
+		}
+		defer gz.Close()
+		body = gz
+	case "deflate":
+		body = newDeflateReader(body)
+	default:
+		return nil, &FetchError{
+			Kind: FetchErrParse,
+			URL:  url,
+			Err:  fmt.Errorf("unsupported content encoding %q", res.Header.Get("Content-Encoding")),
+		}
+	}
+
+	data, err := io.ReadAll(&limitedReader{r: body, n: f.maxBodySize})
+	if err != nil {
+		return nil, &FetchError{Kind: classifyFetchError(err), URL: url, Err: err}
+	}
+
+	return data, nil
+}
+
+// limitedReader is like io.LimitedReader but fails loudly instead of
+// silently truncating the body.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	// A body of exactly the limit is fine, it's only too large if there
+	// is another byte after it.
+	if l.n == 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.n = -1
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// newDeflateReader handles both the zlib-wrapped streams the HTTP spec asks
+// for and the raw deflate streams some servers send instead.
+func newDeflateReader(r io.Reader) io.Reader {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(buffered); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(buffered)
+}
+
+func classifyFetchError(err error) FetchErrorKind {
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return FetchErrTooLarge
+	case errors.Is(err, errTooManyRedirects):
+		return FetchErrRedirect
+	case errors.As(err, &dnsErr):
+		return FetchErrDNS
+	case errors.As(err, &recordErr),
+		errors.As(err, &verifyErr),
+		errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &invalidCertErr):
+		return FetchErrTLS
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return FetchErrTimeout
+	default:
+		return FetchErrConnection
+	}
+}
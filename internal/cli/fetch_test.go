@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadBodyLimit(t *testing.T) {
+	const limit = 1024
+
+	tests := []struct {
+		name    string
+		size    int
+		gzip    bool
+		tooLong bool
+	}{
+		{"under the limit", limit - 1, false, false},
+		{"exactly the limit", limit, false, false},
+		{"one byte over", limit + 1, false, true},
+		{"exactly the limit gzipped", limit, true, false},
+		{"one byte over gzipped", limit + 1, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte("a"), tt.size)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.gzip {
+					w.Header().Set("Content-Encoding", "gzip")
+					zw := gzip.NewWriter(w)
+					zw.Write(body)
+					zw.Close()
+					return
+				}
+				// Flushing first leaves the length unknown, so the limit is
+				// enforced while reading rather than from Content-Length.
+				w.(http.Flusher).Flush()
+				w.Write(body)
+			}))
+			defer server.Close()
+
+			f := newFetcher()
+			f.maxBodySize = limit
+
+			res, err := f.get(context.Background(), server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			data, err := f.readBody(res)
+			if tt.tooLong {
+				if !errors.Is(err, errBodyTooLarge) {
+					t.Fatalf("readBody() error = %v, want %v", err, errBodyTooLarge)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readBody() error = %v", err)
+			}
+			if !bytes.Equal(data, body) {
+				t.Fatalf("readBody() read %d bytes, want %d", len(data), len(body))
+			}
+		})
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	const limit = 1024
+
+	for _, size := range []int{0, limit - 1, limit, limit + 1, 2 * limit} {
+		body := bytes.Repeat([]byte("a"), size)
+		// bytes.Reader reports EOF on its own call after the data, which is
+		// where a body of exactly the limit used to be taken as too large.
+		data, err := io.ReadAll(&limitedReader{r: bytes.NewReader(body), n: limit})
+		if size > limit {
+			if !errors.Is(err, errBodyTooLarge) {
+				t.Errorf("reading %d bytes: error = %v, want %v", size, err, errBodyTooLarge)
+			}
+			continue
+		}
+		if err != nil || len(data) != size {
+			t.Errorf("reading %d bytes: got %d bytes, error = %v", size, len(data), err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"strings"
+)
+
+// newFlagSet returns a flag set for a command's options. Parse errors are
+// returned rather than printed, so handlers can report their own usage.
+func newFlagSet(cmd Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseArgs parses flags wherever they appear among args, unlike
+// flag.FlagSet.Parse which stops at the first positional argument, and
+// returns the positional arguments in order.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseKnownArgs is parseArgs for commands whose positional arguments may
+// start with a dash themselves. Only the flags defined on fs, spelled with two
+// dashes, are parsed. Every other argument is positional, as is everything
+// after "--".
+func parseKnownArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+
+		name, isFlag := strings.CutPrefix(arg, "--")
+		name, _, inline := strings.Cut(name, "=")
+		known := fs.Lookup(name)
+		if !isFlag || known == nil {
+			positional = append(positional, arg)
+			continue
+		}
+
+		flags = append(flags, arg)
+		if boolFlag, ok := known.Value.(interface{ IsBoolFlag() bool }); inline || ok && boolFlag.IsBoolFlag() {
+			continue
+		}
+		if i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+
+	if err := fs.Parse(flags); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
@@ -3,10 +3,10 @@ package cli
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/eleinah/gator/internal/database"
@@ -97,90 +97,23 @@ func HandlerUsers(s *State, cmd Command) error {
 		return fmt.Errorf("error getting users: %w\n", err)
 	}
 
+	records := make([]record, 0, len(users))
 	for _, user := range users {
-		if user == s.Cfg.CurrentUserName {
-			fmt.Printf("* %s (current)\n", user)
-		} else {
-			fmt.Printf("* %s\n", user)
+		records = append(records, record{
+			{"name", user},
+			{"current", user == s.Cfg.CurrentUserName},
+		})
+	}
+
+	return s.render(records, func() {
+		for _, user := range users {
+			if user == s.Cfg.CurrentUserName {
+				fmt.Printf("* %s (current)\n", user)
+			} else {
+				fmt.Printf("* %s\n", user)
+			}
 		}
-	}
-
-	return nil
-}
-
-func HandlerAgg(s *State, cmd Command) error {
-	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
-		return fmt.Errorf("usage: %s <request_wait_time>\n", cmd.Name)
-	}
-
-	waitTime, err := time.ParseDuration(cmd.Args[0])
-	if err != nil {
-		return fmt.Errorf("invalid duration given: %w\n", err)
-	}
-
-	log.Printf("...collecting feeds every %s...", waitTime)
-
-	ticker := time.NewTicker(waitTime)
-
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
-	}
-}
-
-func scrapeFeeds(s *State) {
-	feed, err := s.Db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		log.Printf("couldn't get feeds to fetch: %w\n", err)
-		return
-	}
-
-	log.Println("Found feed to fetch!")
-	scrapeFeed(s.Db, feed)
-}
-
-func scrapeFeed(db *database.Queries, feed database.Feed) {
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
-	if err != nil {
-		log.Printf("couldn't mark feed '%s' as fetched: %v\n", feed.Name, err)
-		return
-	}
-
-	fetchedFeed, err := fetchFeed(context.Background(), feed.Url)
-	if err != nil {
-		log.Printf("couldn't fetch feed '%s': %v", feed.Name, err)
-		return
-	}
-	for _, item := range fetchedFeed.Channel.Item {
-	publishedAt := sql.NullTime{}
-	if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
-		publishedAt = sql.NullTime{
-			Time:  t,
-			Valid: true,
-		}
-	}
-
-	_, err = db.CreatePost(context.Background(), database.CreatePostParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		FeedID:    feed.ID,
-		Title:     item.Title,
-		Description: sql.NullString{
-			String: item.Description,
-			Valid:  true,
-		},
-		Url:         item.Link,
-		PublishedAt: publishedAt,
 	})
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-			continue
-		}
-		log.Printf("Couldn't create post: %v", err)
-		continue
-	}
-	}
-	log.Printf("feed '%s' collected, %v posts found", feed.Name, len(fetchedFeed.Channel.Item))
 }
 
 func HandlerAddFeed(s *State, cmd Command, currentUser database.User) error {
@@ -239,22 +172,63 @@ func HandlerFeeds(s *State, cmd Command) error {
 		return fmt.Errorf("failed to get feeds: %w", err)
 	}
 
-	fmt.Println(`------------
+	records := make([]record, 0, len(feeds))
+	for _, feed := range feeds {
+		records = append(records, feedRecord(feed))
+	}
+
+	return s.render(records, func() {
+		fmt.Println(`------------
    Feeds
 ------------`)
 
-	for _, feed := range feeds {
-		fmt.Printf("\n- Name: '%s'\n", feed.Feedname)
-		fmt.Printf("- URL: '%s'\n", feed.Url)
-		fmt.Printf("- Created by: '%s'\n\n", feed.Createdby)
-	}
+		for _, feed := range feeds {
+			fmt.Printf("\n- Name: '%s'\n", feed.Feedname)
+			fmt.Printf("- URL: '%s'\n", feed.Url)
+			fmt.Printf("- Created by: '%s'\n", feed.Createdby)
+			fmt.Printf("- Status: %s\n", feedStatus(feed))
+			if feed.LastSucceededAt.Valid {
+				fmt.Printf("- Last successful fetch: %s\n", feed.LastSucceededAt.Time.Format(time.DateTime))
+			}
+			fmt.Printf("- Refresh: %s\n", feedRefresh(feed))
+			fmt.Println()
+		}
 
-	fmt.Println(`------------
+		fmt.Println(`------------
     End
 ------------`)
+	})
 
-	return nil
+}
+
+func feedStatus(feed database.GetFeedsRow) string {
+	switch {
+	case feed.DisabledAt.Valid:
+		return fmt.Sprintf("disabled since %s (%s)", feed.DisabledAt.Time.Format(time.DateTime), feed.DisabledReason.String)
+	case feed.ConsecutiveFailures > 0:
+		return fmt.Sprintf("failing, %d failed fetches in a row, last error: %s", feed.ConsecutiveFailures, feed.LastError.String)
+	case !feed.LastFetchedAt.Valid:
+		return "not fetched yet"
+	default:
+		return "healthy"
+	}
+}
+
+func feedRefresh(feed database.GetFeedsRow) string {
+	var refresh string
+	switch {
+	case feed.RefreshIntervalSeconds.Valid:
+		refresh = fmt.Sprintf("every %s (set by user)", time.Duration(feed.RefreshIntervalSeconds.Int32)*time.Second)
+	case feed.AutoIntervalSeconds.Valid:
+		refresh = fmt.Sprintf("every %s (from feed)", time.Duration(feed.AutoIntervalSeconds.Int32)*time.Second)
+	default:
+		refresh = "default interval"
+	}
 
+	if feed.NextFetchAt.Valid {
+		refresh += fmt.Sprintf(", next fetch at %s", feed.NextFetchAt.Time.Format(time.DateTime))
+	}
+	return refresh
 }
 
 func HandlerFollow(s *State, cmd Command, currentUser database.User) error {
@@ -299,18 +273,23 @@ func HandlerFollowing(s *State, cmd Command, currentUser database.User) error {
 		return fmt.Errorf("failed to get followed feeds for user: %w\n", err)
 	}
 
-	if len(following) == 0 {
-		fmt.Println("user is not following any feeds")
-		return nil
+	records := make([]record, 0, len(following))
+	for _, feed := range following {
+		records = append(records, followRecord(feed))
 	}
 
-	fmt.Printf("'%s' is following:\n", currentUser.Name)
+	return s.render(records, func() {
+		if len(following) == 0 {
+			fmt.Println("user is not following any feeds")
+			return
+		}
 
-	for _, feed := range following {
-		fmt.Printf("- %s\n", feed.FeedName)
-	}
+		fmt.Printf("'%s' is following:\n", currentUser.Name)
 
-	return nil
+		for _, feed := range following {
+			fmt.Printf("- %s (%d unread)\n", feed.FeedName, feed.UnreadCount)
+		}
+	})
 }
 
 func HandlerUnfollow(s *State, cmd Command, currentUser database.User) error {
@@ -342,31 +321,264 @@ func HandlerUnfollow(s *State, cmd Command, currentUser database.User) error {
 }
 
 func HandlerBrowse(s *State, cmd Command, user database.User) error {
+	usage := fmt.Errorf("usage: %s [limit] [--feed <url>] [--since <date>] [--until <date>] [--sort published|fetched|feed] [--reverse] [--offset <n> | --after <post-id>] [--unread] [--follow]\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	feedURL := fs.String("feed", "", "only show posts from this feed")
+	since := fs.String("since", "", "only show posts published on or after this date")
+	until := fs.String("until", "", "only show posts published before this date")
+	sort := fs.String("sort", "published", "order posts by publication date, fetch date or feed name")
+	reverse := fs.Bool("reverse", false, "show oldest posts first, or feeds from Z to A")
+	offset := fs.Int("offset", 0, "skip this many posts")
+	after := fs.String("after", "", "continue from where the listing that ended with this post left off")
+	unread := fs.Bool("unread", false, "only show posts that haven't been read yet")
+	follow := fs.Bool("follow", false, "keep running and print new posts as they arrive")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) > 1 {
+		return usage
+	}
+
 	limit := 2
-	if len(cmd.Args) == 1 {
-		if specifiedLimit, err := strconv.Atoi(cmd.Args[0]); err == nil {
+	if len(args) == 1 {
+		if specifiedLimit, err := strconv.Atoi(args[0]); err == nil {
 			limit = specifiedLimit
 		} else {
 			return fmt.Errorf("invalid limit: %w", err)
 		}
 	}
 
-	posts, err := s.Db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-		UserID: user.ID,
-		Limit:  int32(limit),
-	})
+	if *sort != "published" && *sort != "fetched" && *sort != "feed" {
+		return fmt.Errorf("--sort must be published, fetched or feed\n")
+	}
+	if *offset < 0 {
+		return fmt.Errorf("--offset can't be negative\n")
+	}
+	if *offset > 0 && *after != "" {
+		return fmt.Errorf("--offset and --after can't be used together\n")
+	}
+	// The other formats wrap the whole listing, so batches printed one after
+	// another wouldn't read back as one document.
+	if *follow && s.Template == nil && s.Output != "" && s.Output != "text" && s.Output != "jsonl" {
+		return fmt.Errorf("--follow only works with --output text or jsonl, or a --template\n")
+	}
+
+	params := database.BrowsePostsParams{
+		Sort:       *sort,
+		Reverse:    *reverse,
+		UserID:     user.ID,
+		UnreadOnly: *unread,
+		Limit:      int32(limit),
+		Offset:     int32(*offset),
+	}
+
+	if *after != "" {
+		postID, err := resolvePost(s, *after)
+		if err != nil {
+			return err
+		}
+		params.After = uuid.NullUUID{UUID: postID, Valid: true}
+	}
+	if *feedURL != "" {
+		feed, err := s.Db.GetFeedByURL(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("failed to get feed by url: %w\n", err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	if *since != "" {
+		date, err := parseDateArg(*since)
+		if err != nil {
+			return err
+		}
+		params.Since = sql.NullTime{Time: date, Valid: true}
+	}
+	if *until != "" {
+		date, err := parseDateArg(*until)
+		if err != nil {
+			return err
+		}
+		params.Until = sql.NullTime{Time: date, Valid: true}
+	}
+
+	// Started before the initial listing so that posts arriving while it
+	// prints are still picked up when following.
+	var cursor *newPostsCursor
+	if *follow {
+		cursor, err = openNewPostsCursor(s, user, database.GetNewPostsForUserParams{
+			UnreadOnly: params.UnreadOnly,
+			FeedID:     params.FeedID,
+			Since:      params.Since,
+			Until:      params.Until,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	posts, err := s.Db.BrowsePosts(context.Background(), params)
 	if err != nil {
 		return fmt.Errorf("couldn't get posts for user: %w", err)
 	}
 
-	fmt.Printf("found %d posts for user '%s':\n", len(posts), user.Name)
+	err = s.render(postRecords(posts), func() {
+		fmt.Printf("found %d posts for user '%s':\n", len(posts), user.Name)
+		for _, post := range posts {
+			printPost(post)
+		}
+
+		if len(posts) == limit {
+			fmt.Printf("for more, add --after %s\n", shortID(posts[len(posts)-1].ID))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uuid.UUID, 0, len(posts))
 	for _, post := range posts {
-		fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
-		fmt.Printf("--- %s ---\n", post.Title)
-		fmt.Printf("    %v\n", post.Description.String)
-		fmt.Printf("Link: %s\n", post.Url)
-		fmt.Println("=====================================")
+		ids = append(ids, post.ID)
+	}
+	if err := markRead(s, user, ids); err != nil {
+		return err
+	}
+
+	if *follow {
+		cursor.markSeen(posts)
+		return followPosts(s, cursor)
 	}
 
 	return nil
 }
+
+func printPost(post database.BrowsePostsRow) {
+	fmt.Printf("%s from %s [%s]\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName, shortID(post.ID))
+	fmt.Printf("--- %s ---\n", post.Title)
+	fmt.Printf("    %v\n", post.Description.String)
+	fmt.Printf("Link: %s\n", post.Url)
+	fmt.Println("=====================================")
+}
+
+func HandlerEnableFeed(s *State, cmd Command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <url>\n", cmd.Name)
+	}
+
+	feed, err := s.Db.GetFeedByURL(context.Background(), cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get feed by url: %w\n", err)
+	}
+
+	if !feed.DisabledAt.Valid {
+		fmt.Printf("feed '%s' is not disabled\n", feed.Name)
+		return nil
+	}
+
+	if err := s.Db.EnableFeed(context.Background(), feed.ID); err != nil {
+		return fmt.Errorf("failed to enable feed: %w\n", err)
+	}
+
+	fmt.Printf("re-enabled feed '%s' (was disabled: %s)\n", feed.Name, feed.DisabledReason.String)
+	return nil
+}
+
+func HandlerSetInterval(s *State, cmd Command) error {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("usage: %s <url> <duration|auto>\n", cmd.Name)
+	}
+
+	feed, err := s.Db.GetFeedByURL(context.Background(), cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get feed by url: %w\n", err)
+	}
+
+	interval := sql.NullInt32{}
+	if cmd.Args[1] != "auto" {
+		d, err := time.ParseDuration(cmd.Args[1])
+		if err != nil {
+			return fmt.Errorf("invalid duration given: %w\n", err)
+		}
+		if d < time.Minute {
+			return fmt.Errorf("refresh interval must be at least a minute\n")
+		}
+		interval = sql.NullInt32{
+			Int32: int32(d / time.Second),
+			Valid: true,
+		}
+	}
+
+	err = s.Db.SetFeedRefreshInterval(context.Background(), database.SetFeedRefreshIntervalParams{
+		ID:                     feed.ID,
+		RefreshIntervalSeconds: interval,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set refresh interval: %w\n", err)
+	}
+
+	if interval.Valid {
+		fmt.Printf("feed '%s' will be refreshed every %s\n", feed.Name, time.Duration(interval.Int32)*time.Second)
+	} else {
+		fmt.Printf("feed '%s' will be refreshed at the interval it asks for\n", feed.Name)
+	}
+	return nil
+}
+
+func HandlerSetRetention(s *State, cmd Command) error {
+	usage := fmt.Errorf("usage: %s <url> [--posts <n>] [--days <n>]\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	posts := fs.Int("posts", 0, "keep only the newest n posts, 0 for no limit")
+	days := fs.Int("days", 0, "keep only posts from the last n days, 0 for no limit")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 1 {
+		return usage
+	}
+	if *posts < 0 || *days < 0 {
+		return fmt.Errorf("--posts and --days can't be negative\n")
+	}
+
+	feed, err := s.Db.GetFeedByURL(context.Background(), args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get feed by url: %w\n", err)
+	}
+
+	// Limits that aren't given fall back to the configured defaults.
+	params := database.SetFeedRetentionParams{ID: feed.ID}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "posts":
+			params.RetentionPosts = sql.NullInt32{Int32: int32(*posts), Valid: true}
+		case "days":
+			params.RetentionDays = sql.NullInt32{Int32: int32(*days), Valid: true}
+		}
+	})
+
+	if err := s.Db.SetFeedRetention(context.Background(), params); err != nil {
+		return fmt.Errorf("failed to set retention: %w\n", err)
+	}
+
+	fmt.Printf("feed '%s' keeps %s\n", feed.Name, describeRetention(
+		retentionLimit(params.RetentionPosts, s.Cfg.RetentionPosts),
+		retentionLimit(params.RetentionDays, s.Cfg.RetentionDays),
+	))
+	return nil
+}
+
+func retentionLimit(override sql.NullInt32, fallback int) int {
+	if override.Valid {
+		return int(override.Int32)
+	}
+	return fallback
+}
+
+func describeRetention(posts, days int) string {
+	switch {
+	case posts > 0 && days > 0:
+		return fmt.Sprintf("its newest %d posts from the last %d days", posts, days)
+	case posts > 0:
+		return fmt.Sprintf("its newest %d posts", posts)
+	case days > 0:
+		return fmt.Sprintf("posts from the last %d days", days)
+	default:
+		return "every post"
+	}
+}
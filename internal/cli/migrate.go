@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eleinah/gator/internal/migrate"
+	"github.com/eleinah/gator/sql/schema"
+)
+
+func HandlerMigrate(s *State, cmd Command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <up|down|status|redo>\n", cmd.Name)
+	}
+
+	migrations, err := migrate.Load(schema.FS)
+	if err != nil {
+		return fmt.Errorf("couldn't load migrations: %w\n", err)
+	}
+	migrator := migrate.New(s.Conn, migrations)
+	ctx := context.Background()
+
+	switch cmd.Args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %s\n", migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w\n", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return fmt.Errorf("rollback failed: %w\n", err)
+		}
+		if migration == nil {
+			fmt.Println("no migrations to roll back")
+			return nil
+		}
+		fmt.Printf("rolled back %s\n", migration.Name)
+	case "redo":
+		migration, err := migrator.Redo(ctx)
+		if err != nil {
+			return fmt.Errorf("redo failed: %w\n", err)
+		}
+		if migration == nil {
+			fmt.Println("no migrations to redo")
+			return nil
+		}
+		fmt.Printf("redid %s\n", migration.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't get migration status: %w\n", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", appliedAt, status.Migration.Name)
+		}
+	default:
+		return fmt.Errorf("usage: %s <up|down|status|redo>\n", cmd.Name)
+	}
+
+	return nil
+}
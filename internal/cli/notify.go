@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// newPostsChannel is the channel the aggregator notifies on whenever it
+// stores new posts, see NotifyNewPosts. The payload is the feed's id.
+const newPostsChannel = "gator_new_posts"
+
+// newPostsOverlap is how far back each check for new posts looks past the
+// newest post already seen. A post's created_at is stamped by the aggregator
+// before its transaction commits, and concurrent workers or aggregators
+// commit out of order, so a post can become visible after newer ones.
+const newPostsOverlap = 5 * time.Minute
+
+// newPostsCursor tracks which posts have already been seen while following.
+type newPostsCursor struct {
+	user database.User
+	// filter narrows the posts followed, its CreatedAt is set from since.
+	filter database.GetNewPostsForUserParams
+	// since is the newest created_at seen, by the aggregators' clocks.
+	since time.Time
+	// seen holds the posts within newPostsOverlap of since, so those
+	// looked at again aren't reported twice.
+	seen map[uuid.UUID]time.Time
+}
+
+// openNewPostsCursor starts following the user's posts that match filter from
+// the ones stored so far, none of which will be reported as new.
+func openNewPostsCursor(s *State, user database.User, filter database.GetNewPostsForUserParams) (*newPostsCursor, error) {
+	latest, err := s.Db.GetLatestPostCreatedAt(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get latest post: %w", err)
+	}
+
+	filter.UserID = user.ID
+	cursor := &newPostsCursor{
+		user:   user,
+		filter: filter,
+		since:  latest,
+		seen:   make(map[uuid.UUID]time.Time),
+	}
+	if _, err := cursor.next(s); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// next returns the posts stored since the last call that haven't been seen.
+func (c *newPostsCursor) next(s *State) ([]database.GetNewPostsForUserRow, error) {
+	params := c.filter
+	params.CreatedAt = c.since.Add(-newPostsOverlap)
+	posts, err := s.Db.GetNewPostsForUser(context.Background(), params)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get new posts for user: %w", err)
+	}
+
+	var unseen []database.GetNewPostsForUserRow
+	for _, post := range posts {
+		if _, ok := c.seen[post.ID]; ok {
+			continue
+		}
+		unseen = append(unseen, post)
+		c.seen[post.ID] = post.CreatedAt
+		if post.CreatedAt.After(c.since) {
+			c.since = post.CreatedAt
+		}
+	}
+
+	for id, createdAt := range c.seen {
+		if createdAt.Before(c.since.Add(-newPostsOverlap)) {
+			delete(c.seen, id)
+		}
+	}
+	return unseen, nil
+}
+
+// markSeen keeps posts that were already shown from being reported as new.
+func (c *newPostsCursor) markSeen(posts []database.BrowsePostsRow) {
+	for _, post := range posts {
+		if !post.CreatedAt.Before(c.since.Add(-newPostsOverlap)) {
+			c.seen[post.ID] = post.CreatedAt
+		}
+	}
+}
+
+// followPosts prints posts from the user's followed feeds that match the
+// cursor's filter as they arrive, starting after those the cursor has seen,
+// until interrupted.
+func followPosts(s *State, cursor *newPostsCursor) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := newPostsListener(s, func(err error) {
+		log.Printf("listener: %v", err)
+	})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	if s.textOutput() {
+		fmt.Println("...waiting for new posts, press Ctrl-C to stop...")
+	}
+
+	// Catch up once in case posts landed before the listener was ready.
+	if err := printNewPosts(s, cursor); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			// A nil notification means the connection was re-established
+			// and notifications may have been missed, which the cursor
+			// covers just the same.
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+			continue
+		}
+
+		if err := printNewPosts(s, cursor); err != nil {
+			return err
+		}
+	}
+}
+
+// newPostsListener listens for the aggregator's new post notifications. The
+// listener reconnects by itself, passing connection errors to onError.
+func newPostsListener(s *State, onError func(error)) (*pq.Listener, error) {
+	listener := pq.NewListener(s.Cfg.DbUrl, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	})
+
+	if err := listener.Listen(newPostsChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("couldn't listen for new posts: %w", err)
+	}
+	return listener, nil
+}
+
+// printNewPosts prints the posts the cursor hasn't seen yet and marks them
+// as read.
+func printNewPosts(s *State, cursor *newPostsCursor) error {
+	posts, err := cursor.next(s)
+	if err != nil {
+		return err
+	}
+
+	if len(posts) == 0 {
+		return nil
+	}
+
+	// Each batch is rendered on its own, which streams cleanly with
+	// --output jsonl.
+	rows := make([]database.BrowsePostsRow, 0, len(posts))
+	ids := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		rows = append(rows, database.BrowsePostsRow(post))
+		ids = append(ids, post.ID)
+	}
+
+	err = s.render(postRecords(rows), func() {
+		for _, post := range rows {
+			printPost(post)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return markRead(s, cursor.user, ids)
+}
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// outputFormats are the values --output accepts. "text" is each command's
+// own human readable output.
+var outputFormats = []string{"text", "table", "json", "jsonl", "csv", "yaml"}
+
+// field is one named value of a record. Names are snake_case and stable, as
+// scripts depend on them.
+type field struct {
+	name  string
+	value any
+}
+
+// record is one item of a listing, with its fields in display order.
+type record []field
+
+// globalOptions takes the options every command accepts out of args, so
+// handlers never see them.
+func globalOptions(s *State, args []string) ([]string, error) {
+	var rest []string
+	var templateArg string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		// Only the two-dash spelling is taken, a lone "-output" may well be
+		// a search term.
+		option, isOption := strings.CutPrefix(arg, "--")
+		name, value, hasValue := strings.Cut(option, "=")
+		if !isOption || name != "output" && name != "template" {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("--%s needs a value\n", name)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "output":
+			if !validOutput(value) {
+				return nil, fmt.Errorf("unknown output format '%s', use one of: %s\n", value, strings.Join(outputFormats, ", "))
+			}
+			s.Output = value
+		case "template":
+			templateArg = value
+		}
+	}
+
+	if templateArg != "" {
+		if !s.textOutput() {
+			return nil, fmt.Errorf("--template and --output can't be used together\n")
+		}
+		tmpl, err := loadTemplate(s, templateArg)
+		if err != nil {
+			return nil, err
+		}
+		s.Template = tmpl
+	}
+
+	return rest, nil
+}
+
+func validOutput(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// textOutput reports whether commands should print their usual output, which
+// is for people. Anything else, a --template included, is read by scripts and
+// has no headers, progress messages or highlighting.
+func (s *State) textOutput() bool {
+	return s.Template == nil && (s.Output == "" || s.Output == "text")
+}
+
+// render writes records in the format chosen with --output, or through the
+// --template. The default text format calls text instead, which prints the
+// command's usual output.
+func (s *State) render(records []record, text func()) error {
+	if s.Template != nil {
+		return writeTemplate(os.Stdout, s.Template, records)
+	}
+	return writeRecords(os.Stdout, s.Output, records, text)
+}
+
+func writeRecords(w io.Writer, format string, records []record, text func()) error {
+	switch format {
+	case "", "text":
+		text()
+		return nil
+	case "table":
+		return writeTable(w, records)
+	case "json":
+		return writeJSON(w, records)
+	case "jsonl":
+		return writeJSONLines(w, records)
+	case "csv":
+		return writeCSV(w, records)
+	case "yaml":
+		return writeYAML(w, records)
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+}
+
+// plainValue unwraps nullable database values, and turns times into RFC 3339
+// strings in UTC so every format shows them the same way.
+func plainValue(value any) any {
+	switch v := value.(type) {
+	case sql.NullString:
+		if !v.Valid {
+			return nil
+		}
+		return v.String
+	case sql.NullTime:
+		if !v.Valid {
+			return nil
+		}
+		return plainValue(v.Time)
+	case sql.NullInt32:
+		if !v.Valid {
+			return nil
+		}
+		return v.Int32
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// cellValue formats a value for the column based formats, where a missing
+// value is just empty.
+func cellValue(value any) string {
+	switch v := plainValue(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func header(records []record) []string {
+	if len(records) == 0 {
+		return nil
+	}
+	names := make([]string, len(records[0]))
+	for i, f := range records[0] {
+		names[i] = f.name
+	}
+	return names
+}
+
+func writeTable(w io.Writer, records []record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if names := header(records); names != nil {
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(names, "\t")))
+	}
+	for _, r := range records {
+		cells := make([]string, len(r))
+		for i, f := range r {
+			// tabs and newlines would break the columns
+			cells[i] = strings.Join(strings.Fields(cellValue(f.value)), " ")
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// marshalRecord encodes a record as a JSON object, keeping its field order.
+func marshalRecord(r record) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(plainValue(f.value))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSON(w io.Writer, records []record) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, r := range records {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encoded, err := marshalRecord(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+	}
+	buf.WriteByte(']')
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err := indented.WriteTo(w)
+	return err
+}
+
+func writeJSONLines(w io.Writer, records []record) error {
+	for _, r := range records {
+		encoded, err := marshalRecord(r)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, records []record) error {
+	cw := csv.NewWriter(w)
+	if names := header(records); names != nil {
+		cw.Write(names)
+	}
+	for _, r := range records {
+		row := make([]string, len(r))
+		for i, f := range r {
+			row[i] = cellValue(f.value)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeYAML writes records as a YAML sequence of mappings. Strings are
+// always double quoted, which sidesteps YAML's rules for which plain
+// strings would be read back as numbers, booleans or dates.
+func writeYAML(w io.Writer, records []record) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		for i, f := range r {
+			if i == 0 {
+				buf.WriteString("- ")
+			} else {
+				buf.WriteString("  ")
+			}
+			buf.WriteString(f.name)
+			buf.WriteString(": ")
+			buf.WriteString(yamlScalar(plainValue(f.value)))
+			buf.WriteByte('\n')
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func yamlScalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int32, int64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		// Go's escapes are a subset of those in YAML double-quoted strings.
+		return strconv.Quote(v)
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
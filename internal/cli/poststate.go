@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// shortID is how posts are shown to users. Commands that take a post accept
+// it, or any other unique prefix of the post's id.
+func shortID(id uuid.UUID) string {
+	return id.String()[:8]
+}
+
+// resolvePost finds the post whose id starts with ref.
+func resolvePost(s *State, ref string) (uuid.UUID, error) {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	if ref == "" {
+		return uuid.Nil, fmt.Errorf("no post id given")
+	}
+
+	low, high, ok := postIDRange(ref)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("'%s' isn't a post id", ref)
+	}
+
+	ids, err := s.Db.GetPostIDsInRange(context.Background(), database.GetPostIDsInRangeParams{
+		Low:  low,
+		High: high,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("couldn't look up post: %w", err)
+	}
+
+	switch len(ids) {
+	case 0:
+		return uuid.Nil, fmt.Errorf("no post with id '%s'", ref)
+	case 1:
+		return ids[0], nil
+	default:
+		return uuid.Nil, fmt.Errorf("post id '%s' is ambiguous, give more of it", ref)
+	}
+}
+
+// postIDRange returns the lowest and highest ids starting with prefix, which
+// must be up to a whole id of hex digits and dashes.
+func postIDRange(prefix string) (low, high uuid.UUID, ok bool) {
+	if len(prefix) > 36 {
+		return uuid.Nil, uuid.Nil, false
+	}
+	digits := strings.ReplaceAll(prefix, "-", "")
+	if digits == "" || len(digits) > 32 || strings.Trim(digits, "0123456789abcdef") != "" {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	low, err := uuid.Parse(digits + strings.Repeat("0", 32-len(digits)))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	high, err = uuid.Parse(digits + strings.Repeat("f", 32-len(digits)))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return low, high, true
+}
+
+func markRead(s *State, user database.User, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := s.Db.MarkPostsReadByID(context.Background(), database.MarkPostsReadByIDParams{
+		UserID:  user.ID,
+		ReadAt:  time.Now().UTC(),
+		PostIds: ids,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't mark posts as read: %w", err)
+	}
+	return nil
+}
+
+func HandlerRead(s *State, cmd Command, user database.User) error {
+	if len(cmd.Args) == 0 {
+		return fmt.Errorf("usage: %s <post-id>...\n", cmd.Name)
+	}
+
+	var ids []uuid.UUID
+	for _, ref := range cmd.Args {
+		id, err := resolvePost(s, ref)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := markRead(s, user, ids); err != nil {
+		return err
+	}
+
+	fmt.Printf("marked %d posts as read\n", len(ids))
+	return nil
+}
+
+func HandlerMarkRead(s *State, cmd Command, user database.User) error {
+	usage := fmt.Errorf("usage: %s --all | [--feed <url>] [--before <date>]\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	all := fs.Bool("all", false, "mark every post as read")
+	feedURL := fs.String("feed", "", "only mark posts from this feed")
+	before := fs.String("before", "", "only mark posts published before this date, i.e. 2024-01-31")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 0 {
+		return usage
+	}
+	// Requiring --all keeps a bare mark-read from wiping everything.
+	if *all == (*feedURL != "" || *before != "") {
+		return usage
+	}
+
+	params := database.MarkPostsReadParams{
+		ReadAt: time.Now().UTC(),
+		UserID: user.ID,
+	}
+
+	if *feedURL != "" {
+		feed, err := s.Db.GetFeedByURL(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("failed to get feed by url: %w\n", err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	if *before != "" {
+		date, err := parseDateArg(*before)
+		if err != nil {
+			return err
+		}
+		params.Before = sql.NullTime{Time: date, Valid: true}
+	}
+
+	marked, err := s.Db.MarkPostsRead(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("couldn't mark posts as read: %w\n", err)
+	}
+
+	fmt.Printf("marked %d posts as read\n", marked)
+	return nil
+}
+
+// parseDateArg parses a date given on the command line, as a day or as a
+// full timestamp, in UTC like the stored post dates.
+func parseDateArg(value string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, time.DateTime, time.RFC3339} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s', use YYYY-MM-DD\n", value)
+}
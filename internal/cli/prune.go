@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/eleinah/gator/internal/database"
+)
+
+func HandlerPrune(s *State, cmd Command) error {
+	fs := newFlagSet(cmd)
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without removing it")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) != 0 {
+		return fmt.Errorf("usage: %s [--dry-run]\n", cmd.Name)
+	}
+
+	pruned, err := prunePosts(s, *dryRun)
+	if err != nil {
+		return fmt.Errorf("couldn't prune posts: %w\n", err)
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+
+	total := 0
+	feeds := make([]string, 0, len(pruned))
+	for feed, count := range pruned {
+		feeds = append(feeds, feed)
+		total += count
+	}
+	sort.Strings(feeds)
+
+	for _, feed := range feeds {
+		fmt.Printf("%s %d posts from '%s'\n", verb, pruned[feed], feed)
+	}
+	fmt.Printf("%s %d posts in total\n", verb, total)
+	return nil
+}
+
+// prunePosts deletes the posts that fall outside their feed's retention
+// policy and returns how many were deleted per feed name. A dry run does the
+// same work in a transaction that is rolled back, so what it reports is
+// exactly what a real run would remove.
+func prunePosts(s *State, dryRun bool) (map[string]int, error) {
+	ctx := context.Background()
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	names, err := s.Db.WithTx(tx).PrunePosts(ctx, database.PrunePostsParams{
+		DefaultPosts: int32(s.Cfg.RetentionPosts),
+		DefaultDays:  int32(s.Cfg.RetentionDays),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := make(map[string]int)
+	for _, name := range names {
+		pruned[name]++
+	}
+
+	if dryRun {
+		return pruned, nil
+	}
+	return pruned, tx.Commit()
+}
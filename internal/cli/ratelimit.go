@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter keeps a politeness budget per host. Each host gets perHost
+// request slots, matching how many requests hostSlots lets run at once, and
+// once a slot has been used it isn't used again until interval has passed,
+// or until any Retry-After the host asked for has expired. A host is fetched
+// at most perHost times per interval.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	perHost  int
+	// next holds when each of a host's slots may next be used.
+	next map[string][]time.Time
+}
+
+func newHostLimiter(interval time.Duration, perHost int) *hostLimiter {
+	return &hostLimiter{
+		interval: interval,
+		perHost:  perHost,
+		next:     make(map[string][]time.Time),
+	}
+}
+
+// slots returns host's slots. The caller must hold l.mu.
+func (l *hostLimiter) slots(host string) []time.Time {
+	slots, ok := l.next[host]
+	if !ok {
+		slots = make([]time.Time, l.perHost)
+		l.next[host] = slots
+	}
+	return slots
+}
+
+// reserve claims the next request slot for host, reporting false if all of
+// the host's slots are still cooling down.
+func (l *hostLimiter) reserve(host string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots := l.slots(host)
+	for i, next := range slots {
+		if !now.Before(next) {
+			slots[i] = now.Add(l.interval)
+			return true
+		}
+	}
+	return false
+}
+
+// readyAt is when host may next be fetched.
+func (l *hostLimiter) readyAt(host string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots := l.slots(host)
+	ready := slots[0]
+	for _, next := range slots[1:] {
+		if next.Before(ready) {
+			ready = next
+		}
+	}
+	return ready
+}
+
+// backoff keeps host from being fetched before until.
+func (l *hostLimiter) backoff(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots := l.slots(host)
+	for i, next := range slots {
+		if until.After(next) {
+			slots[i] = until
+		}
+	}
+}
+
+// hostSlots caps how many requests may be in flight to each host at once.
+type hostSlots struct {
+	mu      sync.Mutex
+	perHost int
+	slots   map[string]chan struct{}
+}
+
+func newHostSlots(perHost int) *hostSlots {
+	return &hostSlots{
+		perHost: perHost,
+		slots:   make(map[string]chan struct{}),
+	}
+}
+
+// acquire blocks until a request to host may start. The returned func
+// releases the slot.
+func (h *hostSlots) acquire(host string) func() {
+	h.mu.Lock()
+	slot, ok := h.slots[host]
+	if !ok {
+		slot = make(chan struct{}, h.perHost)
+		h.slots[host] = slot
+	}
+	h.mu.Unlock()
+
+	slot <- struct{}{}
+	return func() { <-slot }
+}
+
+func feedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return feedURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
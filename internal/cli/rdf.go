@@ -0,0 +1,50 @@
+package cli
+
+// RDFFeed is an RSS 1.0 document. Unlike RSS 2.0, its items are siblings of
+// the channel rather than children of it.
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		Date            string `xml:"http://purl.org/dc/elements/1.1/ date"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+func (f *RDFFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = f.Channel.Title
+	feed.Channel.Link = f.Channel.Link
+	feed.Channel.Description = f.Channel.Description
+	feed.Channel.PubDate = f.Channel.Date
+	feed.Channel.UpdatePeriod = f.Channel.UpdatePeriod
+	feed.Channel.UpdateFrequency = f.Channel.UpdateFrequency
+
+	for _, item := range f.Item {
+		link := item.Link
+		if link == "" {
+			link = item.About
+		}
+
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        link,
+			Description: item.Description,
+			PubDate:     item.Date,
+		})
+	}
+
+	return &feed
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"github.com/eleinah/gator/internal/database"
+)
+
+// The records commands emit with --output. Field names are part of gator's
+// interface, so only ever add to them.
+
+func postRecord(post database.BrowsePostsRow) record {
+	return record{
+		{"id", post.ID},
+		{"title", post.Title},
+		{"url", post.Url},
+		{"feed", post.FeedName},
+		{"feed_id", post.FeedID},
+		{"published_at", post.PublishedAt},
+		{"fetched_at", post.CreatedAt},
+		{"description", post.Description},
+	}
+}
+
+func postRecords(posts []database.BrowsePostsRow) []record {
+	records := make([]record, 0, len(posts))
+	for _, post := range posts {
+		records = append(records, postRecord(post))
+	}
+	return records
+}
+
+func feedRecord(feed database.GetFeedsRow) record {
+	return record{
+		{"name", feed.Feedname},
+		{"url", feed.Url},
+		{"created_by", feed.Createdby},
+		{"status", feedStatus(feed)},
+		{"last_fetched_at", feed.LastFetchedAt},
+		{"last_succeeded_at", feed.LastSucceededAt},
+		{"consecutive_failures", feed.ConsecutiveFailures},
+		{"last_error", feed.LastError},
+		{"disabled_at", feed.DisabledAt},
+		{"disabled_reason", feed.DisabledReason},
+		{"refresh_interval_seconds", feed.RefreshIntervalSeconds},
+		{"auto_interval_seconds", feed.AutoIntervalSeconds},
+		{"next_fetch_at", feed.NextFetchAt},
+	}
+}
+
+func followRecord(follow database.GetFeedFollowsForUserRow) record {
+	return record{
+		{"feed", follow.FeedName},
+		{"feed_id", follow.FeedID},
+		{"user", follow.UserName},
+		{"followed_at", follow.CreatedAt},
+		{"unread_count", follow.UnreadCount},
+	}
+}
+
+func searchRecord(result database.SearchPostsRow) record {
+	return record{
+		{"id", result.ID},
+		{"title", result.Title},
+		{"url", result.Url},
+		{"feed", result.FeedName},
+		{"published_at", result.PublishedAt},
+		{"rank", result.Rank},
+		{"snippet", result.Snippet},
+	}
+}
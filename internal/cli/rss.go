@@ -1,57 +1,156 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"html"
 	"io"
-	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
 )
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title           string    `xml:"title"`
+		Link            string    `xml:"link"`
+		Description     string    `xml:"description"`
+		PubDate         string    `xml:"pubDate"`
+		LastBuildDate   string    `xml:"lastBuildDate"`
+		TTL             string    `xml:"ttl"`
+		UpdatePeriod    string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		Item            []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
+	GUID        string `xml:"guid"`
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("failed to get feed: %w", err)
+// identity is what makes an item unique within its feed: its guid, or its
+// link for feeds that don't provide one.
+func (item RSSItem) identity() string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+	return strings.TrimSpace(item.Link)
+}
+
+// contentHash fingerprints the parts of an item a reader sees, so edits to
+// an already stored post can be detected. It must match the hash computed in
+// the 008_post_revisions migration.
+func (item RSSItem) contentHash() string {
+	sum := sha256.Sum256([]byte(item.Title + "\n" + item.Link + "\n" + item.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// date is the feed-level publication date, used for items that carry none.
+func (f *RSSFeed) date() string {
+	if f.Channel.PubDate != "" {
+		return f.Channel.PubDate
 	}
+	return f.Channel.LastBuildDate
+}
+
+// feedResponse is the result of fetching a feed along with the cache
+// validators to send on the next request. Feed is nil when NotModified.
+// PermanentURL is set when the feed was only reached through permanent
+// redirects, and is where it should be fetched from now on.
+type feedResponse struct {
+	Feed         *RSSFeed
+	NotModified  bool
+	ETag         string
+	LastModified string
+	PermanentURL string
+}
 
-	req.Header.Set("User-Agent", "gator")
-	log.Printf("User-Agent: %v", req.Header.Get("User-Agent"))
+// fetchFeed downloads and parses a feed. When the feed has stored cache
+// validators the request is made conditional, and a 304 from the server is
+// reported as NotModified rather than an error.
+func (f *fetcher) fetchFeed(ctx context.Context, feed database.Feed) (*feedResponse, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	if feed.Etag.Valid {
+		header.Set("If-None-Match", feed.Etag.String)
+	}
+	if feed.LastModified.Valid {
+		header.Set("If-Modified-Since", feed.LastModified.String)
+	}
 
-	client := http.Client{}
-	res, err := client.Do(req)
+	res, err := f.get(ctx, feed.Url, header)
 	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	response := &feedResponse{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		PermanentURL: permanentRedirect(res),
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		response.NotModified = true
+		response.ETag = feed.Etag.String
+		response.LastModified = feed.LastModified.String
+		return response, nil
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, &FetchError{
+			Kind:       FetchErrHTTPStatus,
+			URL:        feed.Url,
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	body, err := f.readBody(res)
 	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("error reading response body: %w", err)
+		return nil, err
+	}
+
+	parsed, err := parseFeed(res.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, &FetchError{Kind: FetchErrParse, URL: feed.Url, Err: err}
+	}
+	response.Feed = parsed
+	unescapeFeed(parsed)
+
+	return response, nil
+}
+
+// permanentRedirect returns the final URL of a response if every redirect
+// that led to it was permanent (301 or 308), and "" otherwise.
+func permanentRedirect(res *http.Response) string {
+	req := res.Request
+	if req.Response == nil {
+		return ""
 	}
 
-	var feed RSSFeed
-	if err := xml.Unmarshal(body, &feed); err != nil {
-		return &RSSFeed{}, err
+	for r := req; r.Response != nil; r = r.Response.Request {
+		status := r.Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			return ""
+		}
 	}
 
+	return req.URL.String()
+}
+
+func unescapeFeed(feed *RSSFeed) {
 	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
 	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
 
@@ -59,6 +158,102 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
 		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
 	}
+}
+
+// parseFeed detects the feed format from the content type and the document's
+// root element and normalizes it into an RSSFeed.
+func parseFeed(contentType string, body []byte) (*RSSFeed, error) {
+	if isJSONFeed(contentType, body) {
+		var feed JSONFeed
+		if err := json.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("error decoding JSON feed: %w", err)
+		}
+		return feed.toRSS(), nil
+	}
+
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed document: %w", err)
+	}
+
+	switch root {
+	case "rss":
+		var feed RSSFeed
+		if err := newXMLDecoder(body).Decode(&feed); err != nil {
+			return nil, err
+		}
+		return &feed, nil
+	case "feed":
+		var feed AtomFeed
+		if err := newXMLDecoder(body).Decode(&feed); err != nil {
+			return nil, err
+		}
+		return feed.toRSS(), nil
+	case "RDF":
+		var feed RDFFeed
+		if err := newXMLDecoder(body).Decode(&feed); err != nil {
+			return nil, err
+		}
+		return feed.toRSS(), nil
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+}
+
+// newXMLDecoder returns a decoder that also reads the Latin-1 documents
+// common in older feeds. Other non-UTF-8 charsets fail to decode.
+func newXMLDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charsetReader
+	return decoder
+}
+
+// windows1252 maps the bytes 0x80 to 0x9f of windows-1252 to Unicode. Every
+// other byte is the code point of the same value.
+var windows1252 = [32]rune{
+	'\u20ac', '\u0081', '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008d', '\u017d', '\u008f',
+	'\u0090', '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', '\u009d', '\u017e', '\u0178',
+}
+
+// charsetReader converts a document in the charset it declares to UTF-8.
+// ISO-8859-1 is read as windows-1252, its superset, as browsers do, since
+// feeds that declare the former often contain curly quotes from the latter.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "windows-1252", "cp1252", "x-cp1252":
+	default:
+		return nil, fmt.Errorf("unsupported charset '%s'", charset)
+	}
 
-	return &feed, nil
+	latin1, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var decoded strings.Builder
+	decoded.Grow(len(latin1))
+	for _, b := range latin1 {
+		if b >= 0x80 && b < 0xa0 {
+			decoded.WriteRune(windows1252[b-0x80])
+		} else {
+			decoded.WriteRune(rune(b))
+		}
+	}
+	return strings.NewReader(decoded.String()), nil
+}
+
+func rootElement(body []byte) (string, error) {
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
 }
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+func HandlerStar(s *State, cmd Command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id>\n", cmd.Name)
+	}
+
+	postID, err := resolvePost(s, cmd.Args[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.Db.StarPost(context.Background(), database.StarPostParams{
+		UserID: user.ID,
+		PostID: postID,
+		StarredAt: sql.NullTime{
+			Time:  time.Now().UTC(),
+			Valid: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't star post: %w\n", err)
+	}
+
+	fmt.Printf("starred post %s\n", shortID(postID))
+	return nil
+}
+
+func HandlerUnstar(s *State, cmd Command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id>\n", cmd.Name)
+	}
+
+	postID, err := resolvePost(s, cmd.Args[0])
+	if err != nil {
+		return err
+	}
+
+	unstarred, err := s.Db.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't unstar post: %w\n", err)
+	}
+
+	if unstarred == 0 {
+		fmt.Printf("post %s isn't starred\n", shortID(postID))
+		return nil
+	}
+	fmt.Printf("unstarred post %s\n", shortID(postID))
+	return nil
+}
+
+func HandlerSaved(s *State, cmd Command, user database.User) error {
+	if len(cmd.Args) > 0 {
+		return fmt.Errorf("usage: %s\n", cmd.Name)
+	}
+
+	posts, err := s.Db.GetStarredPosts(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get starred posts: %w\n", err)
+	}
+
+	rows := make([]database.BrowsePostsRow, 0, len(posts))
+	for _, post := range posts {
+		rows = append(rows, database.BrowsePostsRow(post))
+	}
+
+	return s.render(postRecords(rows), func() {
+		fmt.Printf("'%s' has %d starred posts:\n", user.Name, len(rows))
+		for _, post := range rows {
+			printPost(post)
+		}
+	})
+}
+
+func HandlerLater(s *State, cmd Command, user database.User) error {
+	usage := fmt.Errorf("usage: %s <list | add <post-id> [--first] | move <post-id> <position> | remove <post-id>>\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	first := fs.Bool("first", false, "add the post to the front of the queue")
+	args, err := parseArgs(fs, cmd.Args)
+	if err != nil || len(args) == 0 {
+		return usage
+	}
+
+	if args[0] == "list" {
+		if len(args) != 1 {
+			return usage
+		}
+		return listQueue(s, user)
+	}
+
+	if len(args) < 2 {
+		return usage
+	}
+	postID, err := resolvePost(s, args[1])
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "add" && len(args) == 2:
+		position := 0
+		if *first {
+			position = 1
+		}
+		position, err = queuePost(s, user, postID, position)
+		if err != nil {
+			return fmt.Errorf("couldn't queue post: %w\n", err)
+		}
+		fmt.Printf("queued post %s at position %d\n", shortID(postID), position)
+	case args[0] == "move" && len(args) == 3:
+		position, err := strconv.Atoi(args[2])
+		if err != nil || position < 1 {
+			return fmt.Errorf("position must be a number from 1\n")
+		}
+		position, err = queuePost(s, user, postID, position)
+		if err != nil {
+			return fmt.Errorf("couldn't move post: %w\n", err)
+		}
+		fmt.Printf("moved post %s to position %d\n", shortID(postID), position)
+	case args[0] == "remove" && len(args) == 2:
+		var removed bool
+		err := withTx(s, func(db *database.Queries) (err error) {
+			removed, err = dequeuePost(db, user, postID)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't remove post from queue: %w\n", err)
+		}
+		if !removed {
+			fmt.Printf("post %s isn't queued\n", shortID(postID))
+			return nil
+		}
+		fmt.Printf("removed post %s from the queue\n", shortID(postID))
+	default:
+		return usage
+	}
+
+	return nil
+}
+
+func listQueue(s *State, user database.User) error {
+	posts, err := s.Db.GetQueuedPosts(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get queued posts: %w\n", err)
+	}
+
+	rows := make([]database.BrowsePostsRow, 0, len(posts))
+	records := make([]record, 0, len(posts))
+	for i, post := range posts {
+		rows = append(rows, database.BrowsePostsRow(post))
+		records = append(records, append(record{{"position", i + 1}}, postRecord(rows[i])...))
+	}
+
+	return s.render(records, func() {
+		if len(rows) == 0 {
+			fmt.Println("the read-later queue is empty")
+			return
+		}
+
+		fmt.Printf("'%s' has %d posts queued to read later:\n", user.Name, len(rows))
+		for i, post := range rows {
+			fmt.Printf("%d. ", i+1)
+			printPost(post)
+		}
+	})
+}
+
+// queuePost puts a post at position in the user's read-later queue, moving
+// it if it's already queued. Position 0 means the end of the queue, as does
+// any position past it. The position the post ended up at is returned.
+func queuePost(s *State, user database.User, postID uuid.UUID, position int) (int, error) {
+	err := withTx(s, func(db *database.Queries) error {
+		if _, err := dequeuePost(db, user, postID); err != nil {
+			return err
+		}
+
+		count, err := db.CountQueuedPosts(context.Background(), user.ID)
+		if err != nil {
+			return err
+		}
+		if position == 0 || position > int(count)+1 {
+			position = int(count) + 1
+		}
+
+		err = db.ShiftQueue(context.Background(), database.ShiftQueueParams{
+			Delta:        1,
+			UserID:       user.ID,
+			FromPosition: int32(position),
+		})
+		if err != nil {
+			return err
+		}
+
+		return db.SetQueuePosition(context.Background(), database.SetQueuePositionParams{
+			UserID: user.ID,
+			PostID: postID,
+			QueuePosition: sql.NullInt32{
+				Int32: int32(position),
+				Valid: true,
+			},
+		})
+	})
+	return position, err
+}
+
+// dequeuePost takes a post out of the user's queue and closes the gap it
+// leaves, reporting whether it was queued at all.
+func dequeuePost(db *database.Queries, user database.User, postID uuid.UUID) (bool, error) {
+	position, err := db.GetQueuePosition(context.Background(), database.GetQueuePositionParams{
+		UserID: user.ID,
+		PostID: postID,
+	})
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !position.Valid {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = db.SetQueuePosition(context.Background(), database.SetQueuePositionParams{
+		UserID: user.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = db.ShiftQueue(context.Background(), database.ShiftQueueParams{
+		Delta:        -1,
+		UserID:       user.ID,
+		FromPosition: position.Int32 + 1,
+	})
+	return err == nil, err
+}
+
+// withTx runs fn with queries bound to a transaction, committing it if fn
+// succeeds.
+func withTx(s *State, fn func(db *database.Queries) error) error {
+	tx, err := s.Conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.Db.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
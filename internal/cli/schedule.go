@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minRefreshInterval = 5 * time.Minute
+	maxRefreshInterval = 24 * time.Hour
+	// observedSampleSize is how many of a feed's newest items are used to
+	// estimate how often it publishes.
+	observedSampleSize = 20
+)
+
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// refreshInterval works out how often a feed should be polled: from its
+// <ttl>, from its sy:updatePeriod and sy:updateFrequency, or failing both
+// from how often it has published recently. The result is clamped so busy
+// feeds aren't hammered and quiet ones are still checked daily.
+func refreshInterval(feed *RSSFeed, fetchedAt time.Time) (time.Duration, bool) {
+	interval, ok := ttlInterval(feed)
+	if !ok {
+		interval, ok = syndicationInterval(feed)
+	}
+	if !ok {
+		interval, ok = observedInterval(feed, fetchedAt)
+	}
+	if !ok {
+		return 0, false
+	}
+
+	return min(max(interval, minRefreshInterval), maxRefreshInterval), true
+}
+
+func ttlInterval(feed *RSSFeed) (time.Duration, bool) {
+	minutes, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL))
+	if err != nil || minutes <= 0 {
+		return 0, false
+	}
+	return time.Duration(minutes) * time.Minute, true
+}
+
+func syndicationInterval(feed *RSSFeed) (time.Duration, bool) {
+	period, ok := syndicationPeriods[strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))]
+	if !ok {
+		return 0, false
+	}
+
+	frequency := 1
+	if n, err := strconv.Atoi(strings.TrimSpace(feed.Channel.UpdateFrequency)); err == nil && n > 0 {
+		frequency = n
+	}
+
+	return period / time.Duration(frequency), true
+}
+
+// observedInterval polls at twice the rate the feed has published at
+// recently, so new posts show up on average within half a posting gap.
+func observedInterval(feed *RSSFeed, fetchedAt time.Time) (time.Duration, bool) {
+	var dates []time.Time
+	for _, item := range feed.Channel.Item {
+		if t, ok := parseFeedDate(item.PubDate); ok && !t.After(fetchedAt) {
+			dates = append(dates, t)
+		}
+	}
+	if len(dates) < 3 {
+		return 0, false
+	}
+
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	dates = dates[:min(len(dates), observedSampleSize)]
+
+	span := dates[0].Sub(dates[len(dates)-1])
+	if span <= 0 {
+		return 0, false
+	}
+
+	return span / time.Duration(len(dates)-1) / 2, true
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+func HandlerSearch(s *State, cmd Command, user database.User) error {
+	usage := fmt.Errorf("usage: %s <query> [--feed <url>] [--since <date>] [--before <date>] [--all] [--limit <n>]\n", cmd.Name)
+
+	fs := newFlagSet(cmd)
+	feedURL := fs.String("feed", "", "only search posts from this feed")
+	since := fs.String("since", "", "only search posts published on or after this date")
+	before := fs.String("before", "", "only search posts published before this date")
+	all := fs.Bool("all", false, "search every feed, not just followed ones")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	// Search terms can start with a dash to exclude a word, so only the
+	// flags above are taken for flags.
+	args, err := parseKnownArgs(fs, cmd.Args)
+	if err != nil || len(args) == 0 || *limit < 1 {
+		return usage
+	}
+
+	query, err := buildTSQuery(joinSearchArgs(args))
+	if err != nil {
+		return err
+	}
+
+	params := database.SearchPostsParams{
+		HeadlineOptions: headlineOptions(s.textOutput()),
+		Query:           query,
+		FollowedOnly:    !*all,
+		UserID:          user.ID,
+		Limit:           int32(*limit),
+	}
+
+	if *feedURL != "" {
+		feed, err := s.Db.GetFeedByURL(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("failed to get feed by url: %w\n", err)
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	if *since != "" {
+		date, err := parseDateArg(*since)
+		if err != nil {
+			return err
+		}
+		params.Since = sql.NullTime{Time: date, Valid: true}
+	}
+	if *before != "" {
+		date, err := parseDateArg(*before)
+		if err != nil {
+			return err
+		}
+		params.Before = sql.NullTime{Time: date, Valid: true}
+	}
+
+	results, err := s.Db.SearchPosts(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("search failed: %w\n", err)
+	}
+
+	records := make([]record, 0, len(results))
+	for _, result := range results {
+		records = append(records, searchRecord(result))
+	}
+
+	return s.render(records, func() {
+		fmt.Printf("found %d posts matching '%s':\n", len(results), strings.Join(args, " "))
+		for _, result := range results {
+			fmt.Printf("%s from %s [%s] (rank %.2f)\n", result.PublishedAt.Time.Format("Mon Jan 2 2006"), result.FeedName, shortID(result.ID), result.Rank)
+			fmt.Printf("--- %s ---\n", result.Title)
+			if result.Snippet != "" {
+				fmt.Printf("    %s\n", result.Snippet)
+			}
+			fmt.Printf("Link: %s\n", result.Url)
+			fmt.Println("=====================================")
+		}
+	})
+}
+
+// headlineOptions configures the snippets Postgres builds around matches.
+// Matches are shown in bold on a terminal and between ** otherwise, or not
+// marked at all when highlight is false.
+func headlineOptions(highlight bool) string {
+	start, stop := "**", "**"
+	if !highlight {
+		start, stop = "", ""
+	} else if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		start, stop = "\x1b[1m", "\x1b[0m"
+	}
+	return fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" ... "`, start, stop)
+}
+
+// buildTSQuery turns a search as a user would type it into a to_tsquery
+// expression. Words must all match, "quoted words" must appear as a phrase,
+// word* matches any word starting with word, -word excludes posts containing
+// it, and OR between two terms matches either.
+func buildTSQuery(input string) (string, error) {
+	var terms []string
+	pendingOr := false
+
+	for input = strings.TrimSpace(input); input != ""; input = strings.TrimSpace(input) {
+		negate := false
+		if input[0] == '-' {
+			negate = true
+			input = input[1:]
+		}
+
+		var token string
+		phrase := false
+		if strings.HasPrefix(input, `"`) {
+			end := strings.Index(input[1:], `"`)
+			if end < 0 {
+				token, input = input[1:], ""
+			} else {
+				token, input = input[1:end+1], input[end+2:]
+			}
+			phrase = true
+		} else {
+			end := strings.IndexFunc(input, unicode.IsSpace)
+			if end < 0 {
+				end = len(input)
+			}
+			token, input = input[:end], input[end:]
+		}
+
+		if token == "OR" && !phrase && !negate {
+			pendingOr = len(terms) > 0
+			continue
+		}
+
+		prefix := !phrase && strings.HasSuffix(token, "*")
+		words := searchWords(token)
+		if len(words) == 0 {
+			continue
+		}
+		if prefix {
+			words[len(words)-1] += ":*"
+		}
+
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		if negate {
+			term = "!" + term
+		}
+
+		if pendingOr {
+			terms[len(terms)-1] += " | " + term
+			pendingOr = false
+			continue
+		}
+		terms = append(terms, term)
+	}
+
+	if len(terms) == 0 {
+		return "", fmt.Errorf("nothing to search for\n")
+	}
+	for i, term := range terms {
+		if strings.Contains(term, " | ") {
+			terms[i] = "(" + term + ")"
+		}
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+// joinSearchArgs puts the query back together from the command line. The
+// shell strips the quotes from a quoted phrase, so an argument with spaces in
+// it is quoted again to be searched as a phrase.
+func joinSearchArgs(args []string) string {
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsFunc(arg, unicode.IsSpace) || strings.Contains(arg, `"`) {
+			terms = append(terms, arg)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(arg, "-"); ok {
+			terms = append(terms, `-"`+rest+`"`)
+			continue
+		}
+		terms = append(terms, `"`+arg+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchWords splits text into the words to_tsquery can take as they are,
+// dropping anything it would read as an operator.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
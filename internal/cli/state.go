@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"database/sql"
+	"text/template"
+
 	"github.com/eleinah/gator/internal/config"
 	"github.com/eleinah/gator/internal/database"
 )
@@ -8,4 +11,10 @@ import (
 type State struct {
 	Db  *database.Queries
 	Cfg *config.Config
+	// Conn is the connection pool behind Db, for starting transactions.
+	Conn *sql.DB
+	// Output is the format listings are written in, see --output.
+	Output string
+	// Template, when set with --template, formats each listed record.
+	Template *template.Template
 }
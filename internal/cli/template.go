@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// loadTemplate resolves a --template value: the name of a template from the
+// config file, @path for a template file, or otherwise the template itself.
+func loadTemplate(s *State, value string) (*template.Template, error) {
+	name, text := "template", value
+	if named, ok := s.Cfg.Templates[value]; ok {
+		name, text = value, named
+	} else if path, ok := strings.CutPrefix(value, "@"); ok {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read template: %w\n", err)
+		}
+		name, text = path, string(contents)
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w\n", err)
+	}
+	return tmpl, nil
+}
+
+var templateFuncs = template.FuncMap{
+	// date formats a time with a Go layout, i.e. {{.published_at | date "2006-01-02"}}.
+	"date": func(layout string, value any) string {
+		t, ok := value.(time.Time)
+		if !ok {
+			return ""
+		}
+		return t.Format(layout)
+	},
+	// truncate shortens a string to at most n runes.
+	"truncate": func(n int, value any) string {
+		s := fmt.Sprint(value)
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n])
+	},
+	// default replaces a missing or empty value.
+	"default": func(fallback string, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// writeTemplate executes tmpl once per record, with the record's fields
+// available by name, i.e. {{.title}}. Each record ends up on its own line.
+func writeTemplate(w io.Writer, tmpl *template.Template, records []record) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		data := make(map[string]any, len(r))
+		for _, f := range r {
+			data[f.name] = templateValue(f.value)
+		}
+
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("couldn't execute template: %w\n", err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// templateValue unwraps nullable database values, leaving times as they are
+// so templates can format them with date.
+func templateValue(value any) any {
+	switch v := value.(type) {
+	case sql.NullString:
+		if !v.Valid {
+			return nil
+		}
+		return v.String
+	case sql.NullTime:
+		if !v.Valid {
+			return nil
+		}
+		return v.Time
+	case sql.NullInt32:
+		if !v.Valid {
+			return nil
+		}
+		return v.Int32
+	default:
+		return value
+	}
+}
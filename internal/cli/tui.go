@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/eleinah/gator/internal/tui"
+)
+
+func HandlerTUI(s *State, cmd Command, user database.User) error {
+	if len(cmd.Args) > 0 {
+		return fmt.Errorf("usage: %s\n", cmd.Name)
+	}
+
+	// Connection errors are left to the listener to retry, since logging
+	// them would scribble over the screen.
+	listener, err := newPostsListener(s, nil)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	updates := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-listener.Notify:
+				select {
+				case updates <- struct{}{}:
+				default:
+				}
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return tui.Run(tui.Options{
+		Db:      s.Db,
+		User:    user,
+		Updates: updates,
+	})
+}
@@ -9,8 +9,16 @@ import (
 const configFileName = ".gatorconfig.json"
 
 type Config struct {
-	DbUrl string `json:"db_url"`
+	DbUrl           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	PostHistory     bool   `json:"post_history,omitempty"`
+	// RetentionPosts and RetentionDays are the default retention policy:
+	// keep the newest N posts of each feed, and posts from the last D days.
+	// Zero means no limit. Feeds can override either, see setretention.
+	RetentionPosts int `json:"retention_posts,omitempty"`
+	RetentionDays  int `json:"retention_days,omitempty"`
+	// Templates are named output templates, usable as --template <name>.
+	Templates map[string]string `json:"templates,omitempty"`
 }
 
 func (c *Config) SetUser(user string) error {
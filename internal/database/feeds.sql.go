@@ -7,11 +7,86 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+WITH claimed AS (
+    UPDATE feeds
+    SET claimed_by = $1,
+        claimed_until = NOW() + $2::int * INTERVAL '1 second'
+    WHERE id IN (
+        SELECT id FROM feeds
+        WHERE disabled_at IS NULL
+          AND (claimed_until IS NULL OR claimed_until < NOW())
+          AND (retry_after IS NULL OR retry_after <= NOW())
+          AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+        LIMIT $3
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, retry_after, disabled_at, disabled_reason, last_succeeded_at, consecutive_failures, last_error, claimed_by, claimed_until, refresh_interval_seconds, auto_interval_seconds, next_fetch_at, retention_posts, retention_days
+)
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, retry_after, disabled_at, disabled_reason, last_succeeded_at, consecutive_failures, last_error, claimed_by, claimed_until, refresh_interval_seconds, auto_interval_seconds, next_fetch_at, retention_posts, retention_days FROM claimed
+ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+`
+
+type ClaimFeedsToFetchParams struct {
+	ClaimedBy    sql.NullString
+	LeaseSeconds int32
+	BatchSize    int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.ClaimedBy, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.RetryAfter,
+			&i.DisabledAt,
+			&i.DisabledReason,
+			&i.LastSucceededAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.ClaimedBy,
+			&i.ClaimedUntil,
+			&i.RefreshIntervalSeconds,
+			&i.AutoIntervalSeconds,
+			&i.NextFetchAt,
+			&i.RetentionPosts,
+			&i.RetentionDays,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -22,7 +97,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, retry_after, disabled_at, disabled_reason, last_succeeded_at, consecutive_failures, last_error, claimed_by, claimed_until, refresh_interval_seconds, auto_interval_seconds, next_fetch_at, retention_posts, retention_days
 `
 
 type CreateFeedParams struct {
@@ -52,13 +127,80 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.RetryAfter,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.LastSucceededAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
+		&i.RefreshIntervalSeconds,
+		&i.AutoIntervalSeconds,
+		&i.NextFetchAt,
+		&i.RetentionPosts,
+		&i.RetentionDays,
 	)
 	return i, err
 }
 
+const deferFeedClaims = `-- name: DeferFeedClaims :exec
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL,
+    next_fetch_at = NOW() + deferred.delay_ms * INTERVAL '1 millisecond'
+FROM unnest($1::uuid[], $2::int[]) AS deferred(id, delay_ms)
+WHERE feeds.id = deferred.id AND feeds.claimed_by = $3
+`
+
+type DeferFeedClaimsParams struct {
+	Ids       []uuid.UUID
+	DelaysMs  []int32
+	ClaimedBy sql.NullString
+}
+
+// Releases feeds whose host is cooling down and moves their next fetch to
+// when the host is ready, so they don't keep the head of ClaimFeedsToFetch
+// from reaching feeds on other hosts.
+func (q *Queries) DeferFeedClaims(ctx context.Context, arg DeferFeedClaimsParams) error {
+	_, err := q.db.ExecContext(ctx, deferFeedClaims, pq.Array(arg.Ids), pq.Array(arg.DelaysMs), arg.ClaimedBy)
+	return err
+}
+
+const disableFeed = `-- name: DisableFeed :exec
+UPDATE feeds
+SET disabled_at = NOW(), disabled_reason = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type DisableFeedParams struct {
+	ID             uuid.UUID
+	DisabledReason sql.NullString
+}
+
+func (q *Queries) DisableFeed(ctx context.Context, arg DisableFeedParams) error {
+	_, err := q.db.ExecContext(ctx, disableFeed, arg.ID, arg.DisabledReason)
+	return err
+}
+
+const enableFeed = `-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL, disabled_reason = NULL, retry_after = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableFeed, id)
+	return err
+}
+
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-where url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, retry_after, disabled_at, disabled_reason, last_succeeded_at, consecutive_failures, last_error, claimed_by, claimed_until, refresh_interval_seconds, auto_interval_seconds, next_fetch_at, retention_posts, retention_days FROM feeds
+WHERE url = $1
+   OR id = (SELECT feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY url = $1 DESC
+LIMIT 1
 `
 
 func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
@@ -72,20 +214,47 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.RetryAfter,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.LastSucceededAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
+		&i.RefreshIntervalSeconds,
+		&i.AutoIntervalSeconds,
+		&i.NextFetchAt,
+		&i.RetentionPosts,
+		&i.RetentionDays,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT feeds.name feedname, feeds.url, users.name createdby
+SELECT feeds.name feedname, feeds.url, users.name createdby,
+    feeds.last_fetched_at, feeds.last_succeeded_at, feeds.consecutive_failures, feeds.last_error,
+    feeds.disabled_at, feeds.disabled_reason,
+    feeds.refresh_interval_seconds, feeds.auto_interval_seconds, feeds.next_fetch_at
 FROM feeds
 JOIN users ON feeds.user_id = users.id
 `
 
 type GetFeedsRow struct {
-	Feedname  string
-	Url       string
-	Createdby string
+	Feedname               string
+	Url                    string
+	Createdby              string
+	LastFetchedAt          sql.NullTime
+	LastSucceededAt        sql.NullTime
+	ConsecutiveFailures    int32
+	LastError              sql.NullString
+	DisabledAt             sql.NullTime
+	DisabledReason         sql.NullString
+	RefreshIntervalSeconds sql.NullInt32
+	AutoIntervalSeconds    sql.NullInt32
+	NextFetchAt            sql.NullTime
 }
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
@@ -97,7 +266,20 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	var items []GetFeedsRow
 	for rows.Next() {
 		var i GetFeedsRow
-		if err := rows.Scan(&i.Feedname, &i.Url, &i.Createdby); err != nil {
+		if err := rows.Scan(
+			&i.Feedname,
+			&i.Url,
+			&i.Createdby,
+			&i.LastFetchedAt,
+			&i.LastSucceededAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.DisabledAt,
+			&i.DisabledReason,
+			&i.RefreshIntervalSeconds,
+			&i.AutoIntervalSeconds,
+			&i.NextFetchAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -111,45 +293,174 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const markFeedFetchFailed = `-- name: MarkFeedFetchFailed :exec
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(),
+    consecutive_failures = consecutive_failures + 1, last_error = $2,
+    claimed_by = NULL, claimed_until = NULL,
+    next_fetch_at = NOW() + LEAST(POWER(2, consecutive_failures + 1), 1440) * INTERVAL '1 minute'
+WHERE id = $1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+type MarkFeedFetchFailedParams struct {
+	ID        uuid.UUID
+	LastError sql.NullString
+}
+
+func (q *Queries) MarkFeedFetchFailed(ctx context.Context, arg MarkFeedFetchFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetchFailed, arg.ID, arg.LastError)
+	return err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :one
+const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = NOW(), last_fetched_at = NOW()
+SET updated_at = NOW(), last_fetched_at = NOW(), last_succeeded_at = NOW(),
+    consecutive_failures = 0, last_error = NULL,
+    claimed_by = NULL, claimed_until = NULL,
+    auto_interval_seconds = COALESCE($1, auto_interval_seconds),
+    next_fetch_at = NOW() + COALESCE(
+        refresh_interval_seconds,
+        $1,
+        auto_interval_seconds,
+        $2::int
+    ) * INTERVAL '1 second'
+WHERE id = $3
+`
+
+type MarkFeedFetchedParams struct {
+	AutoIntervalSeconds    sql.NullInt32
+	DefaultIntervalSeconds int32
+	ID                     uuid.UUID
+}
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.AutoIntervalSeconds, arg.DefaultIntervalSeconds, arg.ID)
+	return err
+}
+
+const releaseFeedClaims = `-- name: ReleaseFeedClaims :exec
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL
+WHERE id = ANY($1::uuid[]) AND claimed_by = $2
+`
+
+type ReleaseFeedClaimsParams struct {
+	Ids       []uuid.UUID
+	ClaimedBy sql.NullString
+}
+
+func (q *Queries) ReleaseFeedClaims(ctx context.Context, arg ReleaseFeedClaimsParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaims, pq.Array(arg.Ids), arg.ClaimedBy)
+	return err
+}
+
+const renewFeedClaim = `-- name: RenewFeedClaim :execrows
+UPDATE feeds
+SET claimed_until = NOW() + $1::int * INTERVAL '1 second'
+WHERE id = $2 AND claimed_by = $3
+`
+
+type RenewFeedClaimParams struct {
+	LeaseSeconds int32
+	ID           uuid.UUID
+	ClaimedBy    sql.NullString
+}
+
+// Extends this process's claim on a feed just before it is fetched. No row is
+// updated if the claim lapsed and another process has taken the feed since.
+func (q *Queries) RenewFeedClaim(ctx context.Context, arg RenewFeedClaimParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, renewFeedClaim, arg.LeaseSeconds, arg.ID, arg.ClaimedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setFeedRefreshInterval = `-- name: SetFeedRefreshInterval :exec
+UPDATE feeds
+SET refresh_interval_seconds = $2, next_fetch_at = NULL, updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, id)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+type SetFeedRefreshIntervalParams struct {
+	ID                     uuid.UUID
+	RefreshIntervalSeconds sql.NullInt32
+}
+
+func (q *Queries) SetFeedRefreshInterval(ctx context.Context, arg SetFeedRefreshIntervalParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRefreshInterval, arg.ID, arg.RefreshIntervalSeconds)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_posts = $2, retention_days = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFeedRetentionParams struct {
+	ID             uuid.UUID
+	RetentionPosts sql.NullInt32
+	RetentionDays  sql.NullInt32
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetention, arg.ID, arg.RetentionPosts, arg.RetentionDays)
+	return err
+}
+
+const setFeedRetryAfter = `-- name: SetFeedRetryAfter :exec
+UPDATE feeds
+SET retry_after = NOW() + $1::int * INTERVAL '1 second'
+WHERE id = $2
+`
+
+type SetFeedRetryAfterParams struct {
+	RetryAfterSeconds int32
+	ID                uuid.UUID
+}
+
+func (q *Queries) SetFeedRetryAfter(ctx context.Context, arg SetFeedRetryAfterParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetryAfter, arg.RetryAfterSeconds, arg.ID)
+	return err
+}
+
+const updateFeedCacheHeaders = `-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3
+WHERE id = $1
+`
+
+type UpdateFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheHeaders(ctx context.Context, arg UpdateFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+WITH moved AS (
+    INSERT INTO feed_url_history (id, created_at, feed_id, url)
+    SELECT gen_random_uuid(), NOW(), feeds.id, feeds.url
+    FROM feeds
+    WHERE feeds.id = $1
+    ON CONFLICT (url) DO NOTHING
+)
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url)
+	return err
 }
@@ -12,13 +12,28 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Name                   string
+	Url                    string
+	UserID                 uuid.UUID
+	LastFetchedAt          sql.NullTime
+	Etag                   sql.NullString
+	LastModified           sql.NullString
+	RetryAfter             sql.NullTime
+	DisabledAt             sql.NullTime
+	DisabledReason         sql.NullString
+	LastSucceededAt        sql.NullTime
+	ConsecutiveFailures    int32
+	LastError              sql.NullString
+	ClaimedBy              sql.NullString
+	ClaimedUntil           sql.NullTime
+	RefreshIntervalSeconds sql.NullInt32
+	AutoIntervalSeconds    sql.NullInt32
+	NextFetchAt            sql.NullTime
+	RetentionPosts         sql.NullInt32
+	RetentionDays          sql.NullInt32
 }
 
 type FeedFollow struct {
@@ -29,15 +44,50 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedUrlHistory struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	FeedID    uuid.UUID
+	Url       string
+}
+
 type Post struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	PublishedAtSource sql.NullString
+	Guid              string
+	ContentHash       string
+	DescriptionText   sql.NullString
+}
+
+type PostRevision struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	PostID      uuid.UUID
 	Title       string
 	Url         string
 	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ContentHash string
+}
+
+type PostState struct {
+	UserID        uuid.UUID
+	PostID        uuid.UUID
+	ReadAt        sql.NullTime
+	StarredAt     sql.NullTime
+	QueuePosition sql.NullInt32
+}
+
+type PrunedPost struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PrunedAt time.Time
 }
 
 type User struct {
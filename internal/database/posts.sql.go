@@ -11,94 +11,272 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
+const adoptLegacyPosts = `-- name: AdoptLegacyPosts :execrows
+UPDATE posts
+SET guid = item.guid
+FROM unnest($1::text[], $2::text[]) AS item(url, guid)
+WHERE posts.feed_id = $3
+  AND posts.url = item.url
+  AND posts.guid = posts.url
+  AND item.guid <> item.url
+  AND NOT EXISTS (
+    SELECT 1 FROM posts existing
+    WHERE existing.feed_id = posts.feed_id AND existing.guid = item.guid
+  )
+`
+
+type AdoptLegacyPostsParams struct {
+	Urls   []string
+	Guids  []string
+	FeedID uuid.UUID
+}
+
+// Posts stored before guids were tracked were given their url as guid. When
+// an item with a different guid links to such a post, the post takes the
+// item's guid instead of the item being stored a second time.
+func (q *Queries) AdoptLegacyPosts(ctx context.Context, arg AdoptLegacyPostsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, adoptLegacyPosts, pq.Array(arg.Urls), pq.Array(arg.Guids), arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const browsePosts = `-- name: BrowsePosts :many
+WITH after_post AS (
+    SELECT posts.id,
+        CASE WHEN $1::text = 'feed' THEN feeds.name ELSE '' END AS sort_name,
+        EXTRACT(EPOCH FROM CASE WHEN $1::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END)
+            * CASE WHEN $2::bool THEN 1 ELSE -1 END AS sort_time
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    WHERE posts.id = $3::uuid
+),
+keyed AS (
+    SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.published_at_source, posts.guid, posts.content_hash, posts.description_text, feeds.name AS feed_name,
+        CASE WHEN $1::text = 'feed' THEN feeds.name ELSE '' END AS sort_name,
+        EXTRACT(EPOCH FROM CASE WHEN $1::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END)
+            * CASE WHEN $2::bool THEN 1 ELSE -1 END AS sort_time
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+    LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+    WHERE feed_follows.user_id = $4
+      AND (NOT $5::bool OR post_states.read_at IS NULL)
+      AND ($6::uuid IS NULL OR posts.feed_id = $6::uuid)
+      AND ($7::timestamp IS NULL OR posts.published_at >= $7::timestamp)
+      AND ($8::timestamp IS NULL OR posts.published_at < $8::timestamp)
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+SELECT keyed.id, keyed.created_at, keyed.updated_at, keyed.title, keyed.url, keyed.description, keyed.published_at, keyed.feed_id, keyed.published_at_source, keyed.guid, keyed.content_hash, keyed.description_text, keyed.feed_name
+FROM keyed
+LEFT JOIN after_post ON TRUE
+WHERE $3::uuid IS NULL
+   OR (NOT $2::bool AND keyed.sort_name > after_post.sort_name)
+   OR ($2::bool AND keyed.sort_name < after_post.sort_name)
+   OR (keyed.sort_name = after_post.sort_name AND (keyed.sort_time, keyed.id) > (after_post.sort_time, after_post.id))
+ORDER BY
+    CASE WHEN $2::bool THEN keyed.sort_name END DESC,
+    CASE WHEN NOT $2::bool THEN keyed.sort_name END ASC,
+    keyed.sort_time ASC,
+    keyed.id ASC
+LIMIT $9 OFFSET $10
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+type BrowsePostsParams struct {
+	Sort       string
+	Reverse    bool
+	After      uuid.NullUUID
+	UserID     uuid.UUID
+	UnreadOnly bool
+	FeedID     uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Limit      int32
+	Offset     int32
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
+type BrowsePostsRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	PublishedAtSource sql.NullString
+	Guid              string
+	ContentHash       string
+	DescriptionText   sql.NullString
+	FeedName          string
+}
+
+// Posts are ordered by (sort_name, sort_time, id). sort_name is the feed name
+// when sorting by feed and empty otherwise, and sort_time is negated for the
+// default newest first order, so that a single keyset comparison against the
+// cursor post works for every sort.
+func (q *Queries) BrowsePosts(ctx context.Context, arg BrowsePostsParams) ([]BrowsePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, browsePosts,
+		arg.Sort,
+		arg.Reverse,
+		arg.After,
+		arg.UserID,
+		arg.UnreadOnly,
 		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Limit,
+		arg.Offset,
 	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BrowsePostsRow
+	for rows.Next() {
+		var i BrowsePostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Guid,
+			&i.ContentHash,
+			&i.DescriptionText,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createPostRevisions = `-- name: CreatePostRevisions :execrows
+INSERT INTO post_revisions (id, created_at, post_id, title, url, description, content_hash)
+SELECT gen_random_uuid(), $1::timestamp, posts.id, posts.title, posts.url, posts.description, posts.content_hash
+FROM posts
+JOIN unnest($2::text[], $3::text[]) AS item(guid, content_hash)
+    ON posts.guid = item.guid
+WHERE posts.feed_id = $4 AND posts.content_hash <> item.content_hash
+`
+
+type CreatePostRevisionsParams struct {
+	CreatedAt     time.Time
+	Guids         []string
+	ContentHashes []string
+	FeedID        uuid.UUID
+}
+
+func (q *Queries) CreatePostRevisions(ctx context.Context, arg CreatePostRevisionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createPostRevisions,
+		arg.CreatedAt,
+		pq.Array(arg.Guids),
+		pq.Array(arg.ContentHashes),
+		arg.FeedID,
 	)
-	return i, err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const forgetPrunedPosts = `-- name: ForgetPrunedPosts :exec
+DELETE FROM pruned_posts
+WHERE feed_id = $1 AND NOT (guid = ANY($2::text[]))
+`
+
+type ForgetPrunedPostsParams struct {
+	FeedID uuid.UUID
+	Guids  []string
+}
+
+// Drops the tombstones of pruned posts their feed no longer lists.
+func (q *Queries) ForgetPrunedPosts(ctx context.Context, arg ForgetPrunedPostsParams) error {
+	_, err := q.db.ExecContext(ctx, forgetPrunedPosts, arg.FeedID, pq.Array(arg.Guids))
+	return err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, feeds.name AS feed_name FROM posts
+const getLatestPostCreatedAt = `-- name: GetLatestPostCreatedAt :one
+SELECT COALESCE(MAX(created_at), 'epoch'::timestamp)::timestamp AS latest FROM posts
+`
+
+func (q *Queries) GetLatestPostCreatedAt(ctx context.Context) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getLatestPostCreatedAt)
+	var latest time.Time
+	err := row.Scan(&latest)
+	return latest, err
+}
+
+const getNewPostsForUser = `-- name: GetNewPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.published_at_source, posts.guid, posts.content_hash, posts.description_text, feeds.name AS feed_name FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1 AND posts.created_at > $2
+  AND (NOT $3::bool OR post_states.read_at IS NULL)
+  AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+  AND ($5::timestamp IS NULL OR posts.published_at >= $5::timestamp)
+  AND ($6::timestamp IS NULL OR posts.published_at < $6::timestamp)
+ORDER BY posts.created_at ASC
 `
 
-type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+type GetNewPostsForUserParams struct {
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	UnreadOnly bool
+	FeedID     uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
 }
 
-type GetPostsForUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-	FeedName    string
+type GetNewPostsForUserRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	PublishedAtSource sql.NullString
+	Guid              string
+	ContentHash       string
+	DescriptionText   sql.NullString
+	FeedName          string
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+// Takes the same filters as BrowsePosts, so following a listing keeps to it.
+func (q *Queries) GetNewPostsForUser(ctx context.Context, arg GetNewPostsForUserParams) ([]GetNewPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNewPostsForUser,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.UnreadOnly,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsForUserRow
+	var items []GetNewPostsForUserRow
 	for rows.Next() {
-		var i GetPostsForUserRow
+		var i GetNewPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -108,7 +286,210 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Guid,
+			&i.ContentHash,
+			&i.DescriptionText,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostIDsInRange = `-- name: GetPostIDsInRange :many
+SELECT id FROM posts
+WHERE id BETWEEN $1::uuid AND $2::uuid
+ORDER BY id
+LIMIT 2
+`
+
+type GetPostIDsInRangeParams struct {
+	Low  uuid.UUID
+	High uuid.UUID
+}
+
+// The ids sharing a prefix form a range, which the primary key can look up.
+func (q *Queries) GetPostIDsInRange(ctx context.Context, arg GetPostIDsInRangeParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getPostIDsInRange, arg.Low, arg.High)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const notifyNewPosts = `-- name: NotifyNewPosts :exec
+SELECT pg_notify('gator_new_posts', $1::uuid::text)
+`
+
+func (q *Queries) NotifyNewPosts(ctx context.Context, feedID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, notifyNewPosts, feedID)
+	return err
+}
+
+const prunePosts = `-- name: PrunePosts :many
+WITH ranked AS (
+    SELECT posts.id,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position,
+        COALESCE(posts.published_at, posts.created_at) AS dated_at,
+        COALESCE(feeds.retention_posts, $1::int) AS keep_posts,
+        COALESCE(feeds.retention_days, $2::int) AS keep_days
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    -- starred and queued posts are kept whatever the policy says
+    WHERE NOT EXISTS (
+        SELECT 1 FROM post_states
+        WHERE post_states.post_id = posts.id
+          AND (post_states.starred_at IS NOT NULL OR post_states.queue_position IS NOT NULL)
+    )
+),
+pruned AS (
+    DELETE FROM posts
+    USING ranked, feeds
+    WHERE posts.id = ranked.id AND feeds.id = posts.feed_id
+      AND (
+        (ranked.keep_posts > 0 AND ranked.position > ranked.keep_posts)
+        OR (ranked.keep_days > 0 AND ranked.dated_at < (NOW() AT TIME ZONE 'UTC') - ranked.keep_days * INTERVAL '1 day')
+      )
+    RETURNING posts.feed_id, posts.guid, feeds.name
+),
+tombstones AS (
+    INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+    SELECT feed_id, guid, NOW() AT TIME ZONE 'UTC' FROM pruned
+    ON CONFLICT DO NOTHING
+)
+SELECT name FROM pruned
+`
+
+type PrunePostsParams struct {
+	DefaultPosts int32
+	DefaultDays  int32
+}
+
+// Pruned posts leave a tombstone behind, which keeps UpsertPosts from storing
+// them again while the feed still lists them.
+func (q *Queries) PrunePosts(ctx context.Context, arg PrunePostsParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, prunePosts, arg.DefaultPosts, arg.DefaultDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT posts.id, posts.url, posts.published_at, feeds.name AS feed_name,
+    ts_rank_cd(
+        setweight(to_tsvector('english', posts.title), 'A') ||
+        setweight(to_tsvector('english', COALESCE(posts.description_text, '')), 'B'),
+        query
+    ) AS rank,
+    ts_headline('english', posts.title, query, $1::text) AS title,
+    ts_headline('english', COALESCE(posts.description_text, ''), query, $1::text) AS snippet
+FROM posts
+JOIN feeds ON feeds.id = posts.feed_id,
+    to_tsquery('english', $2::text) AS query
+WHERE (
+        setweight(to_tsvector('english', posts.title), 'A') ||
+        setweight(to_tsvector('english', COALESCE(posts.description_text, '')), 'B')
+    ) @@ query
+  AND (NOT $3::bool OR posts.feed_id IN (
+        SELECT feed_follows.feed_id FROM feed_follows WHERE feed_follows.user_id = $4
+    ))
+  AND ($5::uuid IS NULL OR posts.feed_id = $5::uuid)
+  AND ($6::timestamp IS NULL OR posts.published_at >= $6::timestamp)
+  AND ($7::timestamp IS NULL OR posts.published_at < $7::timestamp)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $8
+`
+
+type SearchPostsParams struct {
+	HeadlineOptions string
+	Query           string
+	FollowedOnly    bool
+	UserID          uuid.UUID
+	FeedID          uuid.NullUUID
+	Since           sql.NullTime
+	Before          sql.NullTime
+	Limit           int32
+}
+
+type SearchPostsRow struct {
+	ID          uuid.UUID
+	Url         string
+	PublishedAt sql.NullTime
+	FeedName    string
+	Rank        float32
+	Title       string
+	Snippet     string
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.HeadlineOptions,
+		arg.Query,
+		arg.FollowedOnly,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.Before,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.PublishedAt,
 			&i.FeedName,
+			&i.Rank,
+			&i.Title,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -122,3 +503,87 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, content_hash, description_text)
+SELECT gen_random_uuid(), $1::timestamp, $1::timestamp,
+    item.title, item.url, item.description, item.published_at, $2::uuid,
+    item.published_at_source, item.guid, item.content_hash, item.description_text
+FROM unnest(
+    $3::text[],
+    $4::text[],
+    $5::text[],
+    $6::timestamp[],
+    $7::text[],
+    $8::text[],
+    $9::text[],
+    $10::text[]
+) AS item(title, url, description, published_at, published_at_source, guid, content_hash, description_text)
+WHERE NOT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE pruned_posts.feed_id = $2::uuid AND pruned_posts.guid = item.guid
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    description_text = EXCLUDED.description_text,
+    published_at = CASE WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at ELSE posts.published_at END,
+    published_at_source = CASE WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at_source ELSE posts.published_at_source END,
+    content_hash = EXCLUDED.content_hash
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING guid, (xmax = 0) AS inserted
+`
+
+type UpsertPostsParams struct {
+	FetchedAt          time.Time
+	FeedID             uuid.UUID
+	Titles             []string
+	Urls               []string
+	Descriptions       []string
+	PublishedAts       []time.Time
+	PublishedAtSources []string
+	Guids              []string
+	ContentHashes      []string
+	DescriptionTexts   []string
+}
+
+type UpsertPostsRow struct {
+	Guid     string
+	Inserted bool
+}
+
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]UpsertPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		arg.FetchedAt,
+		arg.FeedID,
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.PublishedAtSources),
+		pq.Array(arg.Guids),
+		pq.Array(arg.ContentHashes),
+		pq.Array(arg.DescriptionTexts),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertPostsRow
+	for rows.Next() {
+		var i UpsertPostsRow
+		if err := rows.Scan(&i.Guid, &i.Inserted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,32 @@
+// Package htmltext turns the HTML found in feed descriptions into plain
+// text, for the terminal and for search.
+package htmltext
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	breakTags  = regexp.MustCompile(`(?i)<\s*(br|/p|p|/div|/li|/h[1-6])\b[^>]*>`)
+	listTags   = regexp.MustCompile(`(?i)<\s*li\b[^>]*>`)
+	anyTag     = regexp.MustCompile(`<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText keeps paragraph and line breaks from an HTML fragment and drops
+// all other markup.
+func PlainText(description string) string {
+	text := breakTags.ReplaceAllString(description, "\n")
+	text = listTags.ReplaceAllString(text, "\n• ")
+	text = anyTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = strings.ReplaceAll(text, "\r", "")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,322 @@
+// Package migrate applies goose-annotated SQL migrations. Applied versions
+// are tracked in goose's own goose_db_version table, so databases already
+// migrated with the goose CLI carry on from where they are.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// NoTransaction is set by a "-- +goose NO TRANSACTION" annotation, for
+	// statements like CREATE INDEX CONCURRENTLY that can't run in one.
+	NoTransaction bool
+}
+
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// lockID is an arbitrary key for the advisory lock that keeps two gator
+// processes from migrating the same database at once.
+const lockID = 7342461
+
+// Load reads every NNN_name.sql migration in fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int64]string)
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", file)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+
+		contents, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", file, err)
+		}
+		migration.Version = version
+		migration.Name = name
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parse splits a migration into its Up and Down sections. Since each section
+// runs as a single multi-statement query, StatementBegin and StatementEnd
+// annotations need no handling beyond being dropped.
+func parse(contents string) (Migration, error) {
+	var migration Migration
+	var up, down strings.Builder
+	var section *strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if !ok {
+			if section != nil {
+				section.WriteString(line)
+				section.WriteString("\n")
+			}
+			continue
+		}
+
+		switch strings.TrimSpace(annotation) {
+		case "Up":
+			section = &up
+		case "Down":
+			section = &down
+		case "NO TRANSACTION":
+			migration.NoTransaction = true
+		case "StatementBegin", "StatementEnd":
+		default:
+			return migration, fmt.Errorf("unknown annotation %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return migration, err
+	}
+
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	if migration.Up == "" {
+		return migration, fmt.Errorf("no -- +goose Up section")
+	}
+	return migration, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies every pending migration in order and returns the ones applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migration, returning nil if
+// there was nothing to roll back.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var rolledBack *Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		migration, err := m.latestApplied(ctx, conn)
+		if err != nil || migration == nil {
+			return err
+		}
+		if err := run(ctx, conn, *migration, false); err != nil {
+			return err
+		}
+		rolledBack = migration
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		migration, err := m.latestApplied(ctx, conn)
+		if err != nil || migration == nil {
+			return err
+		}
+		if err := run(ctx, conn, *migration, false); err != nil {
+			return err
+		}
+		if err := run(ctx, conn, *migration, true); err != nil {
+			return err
+		}
+		redone = migration
+		return nil
+	})
+	return redone, err
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := versions[migration.Version]
+			statuses = append(statuses, Status{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) latestApplied(ctx context.Context, conn *sql.Conn) (*Migration, error) {
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if _, ok := versions[m.migrations[i].Version]; ok {
+			return &m.migrations[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// locked runs fn on a single connection holding the migration lock, creating
+// the version table first if this database has never been migrated.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("couldn't take migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS goose_db_version (
+    id SERIAL PRIMARY KEY,
+    version_id BIGINT NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP NULL DEFAULT NOW()
+)`)
+	if err != nil {
+		return fmt.Errorf("couldn't create version table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns when each applied version was applied. Only the
+// latest row for a version counts, as older goose releases recorded
+// rollbacks as rows with is_applied = false.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT DISTINCT ON (version_id) version_id, is_applied, tstamp
+FROM goose_db_version
+WHERE version_id > 0
+ORDER BY version_id, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var applied bool
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &applied, &appliedAt); err != nil {
+			return nil, err
+		}
+		if applied {
+			versions[version] = appliedAt.Time
+		}
+	}
+	return versions, rows.Err()
+}
+
+// run applies (up) or rolls back a migration and records it, inside one
+// transaction unless the migration opted out of it.
+func run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	statement, record := migration.Up, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, TRUE)"
+	direction := "apply"
+	if !up {
+		statement, record = migration.Down, "DELETE FROM goose_db_version WHERE version_id = $1"
+		direction = "roll back"
+	}
+
+	if migration.NoTransaction {
+		if statement != "" {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("couldn't %s %s: %w", direction, migration.Name, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, record, migration.Version); err != nil {
+			return fmt.Errorf("couldn't record %s: %w", migration.Name, err)
+		}
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if statement != "" {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("couldn't %s %s: %w", direction, migration.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, migration.Version); err != nil {
+		return fmt.Errorf("couldn't record %s: %w", migration.Name, err)
+	}
+
+	return tx.Commit()
+}
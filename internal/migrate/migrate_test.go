@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/eleinah/gator/sql/schema"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     Migration
+		wantErr  bool
+	}{
+		{
+			name: "up and down",
+			contents: `-- +goose Up
+CREATE TABLE users (id UUID PRIMARY KEY);
+
+-- +goose Down
+DROP TABLE users;
+`,
+			want: Migration{
+				Up:   "CREATE TABLE users (id UUID PRIMARY KEY);",
+				Down: "DROP TABLE users;",
+			},
+		},
+		{
+			name: "up only",
+			contents: `-- +goose Up
+ALTER TABLE users ADD COLUMN name TEXT;
+`,
+			want: Migration{
+				Up: "ALTER TABLE users ADD COLUMN name TEXT;",
+			},
+		},
+		{
+			name: "text before the first section is dropped",
+			contents: `-- adds the users table
+-- +goose Up
+SELECT 1;
+-- +goose Down
+SELECT 2;
+`,
+			want: Migration{
+				Up:   "SELECT 1;",
+				Down: "SELECT 2;",
+			},
+		},
+		{
+			name: "plain comments are kept",
+			contents: `-- +goose Up
+-- the index must match the query
+CREATE INDEX posts_idx ON posts (id);
+-- +goose Down
+DROP INDEX posts_idx;
+`,
+			want: Migration{
+				Up:   "-- the index must match the query\nCREATE INDEX posts_idx ON posts (id);",
+				Down: "DROP INDEX posts_idx;",
+			},
+		},
+		{
+			name: "statement blocks",
+			contents: `-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION one() RETURNS int AS $$
+BEGIN
+    RETURN 1;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION one();
+-- +goose StatementEnd
+`,
+			want: Migration{
+				Up:   "CREATE FUNCTION one() RETURNS int AS $$\nBEGIN\n    RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;",
+				Down: "DROP FUNCTION one();",
+			},
+		},
+		{
+			name: "no transaction",
+			contents: `-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX CONCURRENTLY posts_idx ON posts (id);
+-- +goose Down
+DROP INDEX CONCURRENTLY posts_idx;
+`,
+			want: Migration{
+				Up:            "CREATE INDEX CONCURRENTLY posts_idx ON posts (id);",
+				Down:          "DROP INDEX CONCURRENTLY posts_idx;",
+				NoTransaction: true,
+			},
+		},
+		{
+			name: "indented annotations",
+			contents: `  -- +goose Up
+SELECT 1;
+	-- +goose Down
+SELECT 2;
+`,
+			want: Migration{
+				Up:   "SELECT 1;",
+				Down: "SELECT 2;",
+			},
+		},
+		{
+			name:     "no up section",
+			contents: "-- +goose Down\nDROP TABLE users;\n",
+			wantErr:  true,
+		},
+		{
+			name:     "empty up section",
+			contents: "-- +goose Up\n\n-- +goose Down\nDROP TABLE users;\n",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown annotation",
+			contents: "-- +goose Up\n-- +goose Sideways\nSELECT 1;\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(tt.contents)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parse() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_posts.sql": {Data: []byte("-- +goose Up\nSELECT 2;\n")},
+		"001_users.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		"embed.go":      {Data: []byte("package schema\n")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Load() returned %d migrations, want 2", len(migrations))
+	}
+	for i, want := range []struct {
+		version int64
+		name    string
+	}{{1, "001_users"}, {2, "002_posts"}} {
+		if migrations[i].Version != want.version || migrations[i].Name != want.name {
+			t.Errorf("migration %d is %d %s, want %d %s", i, migrations[i].Version, migrations[i].Name, want.version, want.name)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"no version": {
+			"users.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		},
+		"shared version": {
+			"001_users.sql":    {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+			"1_also_users.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		},
+		"bad contents": {
+			"001_users.sql": {Data: []byte("SELECT 1;\n")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(fsys); err == nil {
+				t.Fatal("Load() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	migrations, err := Load(schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 20 {
+		t.Fatalf("loaded %d migrations, want 20", len(migrations))
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %s is missing its Up or Down section", migration.Name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	styleReset    = "\x1b[0m"
+	styleBold     = "\x1b[1m"
+	styleDim      = "\x1b[2m"
+	styleSelected = "\x1b[7m"
+)
+
+// Pane widths. The reader gets whatever is left.
+func (a *app) feedsWidth() int {
+	return clamp(a.width/5, 12, 32)
+}
+
+func (a *app) postsWidth() int {
+	return clamp(a.width*2/5, 20, 70)
+}
+
+func (a *app) readerWidth() int {
+	return max(a.width-a.feedsWidth()-a.postsWidth()-2, 0)
+}
+
+// listHeight is the number of rows below the pane headers, above the status
+// bar.
+func (a *app) listHeight() int {
+	return max(a.height-2, 1)
+}
+
+func (a *app) draw() {
+	height := a.listHeight()
+	a.feedTop = scrollTo(a.feedTop, a.feedIndex, height)
+	a.postTop = scrollTo(a.postTop, a.postIndex, height)
+
+	out := a.term.out
+	out.WriteString("\x1b[H")
+
+	a.writeHeader(a.feedsWidth(), "Feeds", a.focus == feedsPane)
+	out.WriteString("│")
+	a.writeHeader(a.postsWidth(), "Posts", a.focus == postsPane)
+	out.WriteString("│")
+	a.writeHeader(a.readerWidth(), "Reader", a.focus == readerPane)
+	out.WriteString("\x1b[K\r\n")
+
+	for row := 0; row < height; row++ {
+		a.writeFeedRow(a.feedTop + row)
+		out.WriteString("│")
+		a.writePostRow(a.postTop + row)
+		out.WriteString("│")
+		a.writeReaderRow(a.readerTop + row)
+		out.WriteString("\x1b[K\r\n")
+	}
+
+	status := a.status
+	if status == "" {
+		status = help
+	}
+	out.WriteString(styleSelected + fit(" "+status, a.width) + styleReset)
+	out.Flush()
+}
+
+func (a *app) writeHeader(width int, title string, focused bool) {
+	style := styleDim
+	if focused {
+		style = styleBold
+	}
+	a.term.out.WriteString(style + fit(" "+title, width) + styleReset)
+}
+
+func (a *app) writeFeedRow(index int) {
+	width := a.feedsWidth()
+	if index >= len(a.feeds) {
+		a.term.out.WriteString(fit("", width))
+		return
+	}
+
+	feed := a.feeds[index]
+	text := " " + feed.FeedName
+	if feed.UnreadCount > 0 {
+		text = fmt.Sprintf("%s (%d)", text, feed.UnreadCount)
+	}
+	a.writeCell(text, width, index == a.feedIndex, a.focus == feedsPane, feed.UnreadCount > 0)
+}
+
+func (a *app) writePostRow(index int) {
+	width := a.postsWidth()
+	if index >= len(a.posts) {
+		a.term.out.WriteString(fit("", width))
+		return
+	}
+
+	post := a.posts[index]
+	state := a.states[post.ID]
+	marks := []rune("  ")
+	if !state.ReadAt.Valid {
+		marks[0] = '●'
+	}
+	if state.StarredAt.Valid {
+		marks[1] = '★'
+	}
+
+	text := fmt.Sprintf("%s %s %s", string(marks), post.PublishedAt.Time.Format("Jan 02"), post.Title)
+	a.writeCell(text, width, index == a.postIndex, a.focus == postsPane, !state.ReadAt.Valid)
+}
+
+func (a *app) writeReaderRow(index int) {
+	width := a.readerWidth()
+	if index >= len(a.readerLines) {
+		a.term.out.WriteString(fit("", width))
+		return
+	}
+
+	text := " " + a.readerLines[index]
+	if index < a.titleLines {
+		a.term.out.WriteString(styleBold + fit(text, width) + styleReset)
+		return
+	}
+	a.term.out.WriteString(fit(text, width))
+}
+
+// writeCell writes one row of a list. The selected row is highlighted in the
+// focused pane and marked with a caret in the others.
+func (a *app) writeCell(text string, width int, selected, focused, bold bool) {
+	style := ""
+	if bold {
+		style = styleBold
+	}
+
+	if selected {
+		if focused {
+			style += styleSelected
+		} else {
+			text = ">" + strings.TrimPrefix(text, " ")
+		}
+	}
+	a.term.out.WriteString(style + fit(text, width) + styleReset)
+}
+
+// scrollTo returns the first visible row of a list so that index is on
+// screen, moving as little as possible from top.
+func scrollTo(top, index, height int) int {
+	if index < top {
+		return index
+	}
+	if index >= top+height {
+		return index - height + 1
+	}
+	return top
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tui
+
+import "os"
+
+// notifyResize does nothing where there is no SIGWINCH, the terminal's size
+// is only read when the reader starts.
+func notifyResize(c chan<- os.Signal) {}
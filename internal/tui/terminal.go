@@ -0,0 +1,151 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// terminal puts the controlling terminal in raw mode on the alternate screen
+// for as long as the UI runs. Terminal modes are changed through stty, which
+// keeps gator free of platform specific ioctls.
+type terminal struct {
+	out   *bufio.Writer
+	saved string
+}
+
+func openTerminal() (*terminal, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("the tui needs an interactive terminal")
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read terminal settings: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("couldn't set up terminal: %w", err)
+	}
+
+	t := &terminal{
+		out:   bufio.NewWriterSize(os.Stdout, 64*1024),
+		saved: saved,
+	}
+	// alternate screen, hidden cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	t.out.Flush()
+	return t, nil
+}
+
+func (t *terminal) close() {
+	t.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	t.out.Flush()
+	stty(t.saved)
+}
+
+func (t *terminal) size() (width, height int, err error) {
+	out, err := stty("size")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected terminal size '%s'", out)
+	}
+	height, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	width, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// readKeys turns raw terminal input into key names: "up", "down", "left",
+// "right", "pgup", "pgdown", "home", "end", "enter", "tab", "esc", "ctrl+c",
+// "backspace", or the typed character itself. keys is closed when input
+// ends.
+func readKeys(in io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"OA": "up", "OB": "down", "OC": "right", "OD": "left",
+	"[H": "home", "[F": "end", "[1~": "home", "[4~": "end",
+	"[5~": "pgup", "[6~": "pgdown", "[Z": "backtab",
+}
+
+func parseKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		switch b := input[0]; {
+		case b == 0x1b:
+			key, size := parseEscape(input[1:])
+			keys = append(keys, key)
+			input = input[1+size:]
+		case b == '\r' || b == '\n':
+			keys = append(keys, "enter")
+			input = input[1:]
+		case b == '\t':
+			keys = append(keys, "tab")
+			input = input[1:]
+		case b == 3:
+			keys = append(keys, "ctrl+c")
+			input = input[1:]
+		case b == 127 || b == 8:
+			keys = append(keys, "backspace")
+			input = input[1:]
+		default:
+			r, size := utf8.DecodeRune(input)
+			keys = append(keys, string(r))
+			input = input[size:]
+		}
+	}
+	return keys
+}
+
+// parseEscape reads the rest of an escape sequence, returning the key and
+// how many bytes it used. Unknown sequences are swallowed whole.
+func parseEscape(input []byte) (string, int) {
+	if len(input) == 0 || input[0] != '[' && input[0] != 'O' {
+		return "esc", 0
+	}
+
+	// A sequence ends with its first byte in the range @ to ~.
+	for i := 1; i < len(input); i++ {
+		if input[i] >= '@' && input[i] <= '~' {
+			if key, ok := escapeKeys[string(input[:i+1])]; ok {
+				return key, i + 1
+			}
+			return "", i + 1
+		}
+	}
+	return "", len(input)
+}
@@ -0,0 +1,495 @@
+// Package tui is gator's full-screen reader: a feed list, a post list and a
+// reader pane side by side, driven from the keyboard.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/eleinah/gator/internal/database"
+	"github.com/eleinah/gator/internal/htmltext"
+	"github.com/google/uuid"
+)
+
+type Options struct {
+	Db   *database.Queries
+	User database.User
+	// Updates receives a value whenever new posts may have arrived. The
+	// lists are reloaded when it does.
+	Updates <-chan struct{}
+}
+
+type pane int
+
+const (
+	feedsPane pane = iota
+	postsPane
+	readerPane
+)
+
+// postLimit caps how many posts are listed for a feed at once.
+const postLimit = 500
+
+const help = "j/k move  tab/h/l switch pane  enter read  n/p next/prev  s star  m read/unread  o open  r refresh  q quit"
+
+type app struct {
+	db   *database.Queries
+	user database.User
+	term *terminal
+
+	width, height int
+	focus         pane
+
+	// feeds[0] is a stand-in for all followed feeds together.
+	feeds     []database.GetFeedFollowsForUserRow
+	feedIndex int
+	feedTop   int
+
+	posts     []database.BrowsePostsRow
+	states    map[uuid.UUID]database.PostState
+	postIndex int
+	postTop   int
+
+	// readingID is the post shown in the reader. It is kept by id and
+	// looked up in posts, which every reload replaces.
+	readingID   uuid.UUID
+	readerLines []string
+	readerTop   int
+	// titleLines is how many of readerLines hold the post's title.
+	titleLines int
+
+	status string
+}
+
+func Run(opts Options) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.close()
+
+	a := &app{
+		db:     opts.Db,
+		user:   opts.User,
+		term:   term,
+		states: make(map[uuid.UUID]database.PostState),
+	}
+	a.resize()
+
+	if err := a.reload(); err != nil {
+		return err
+	}
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	for {
+		a.draw()
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := a.handleKey(key); quit {
+				return nil
+			}
+		case <-resized:
+			a.resize()
+		case <-opts.Updates:
+			if err := a.reload(); err != nil {
+				a.status = err.Error()
+			} else {
+				a.status = "new posts arrived " + time.Now().Format(time.Kitchen)
+			}
+		}
+	}
+}
+
+func (a *app) resize() {
+	width, height, err := a.term.size()
+	if err != nil {
+		width, height = 80, 24
+	}
+	a.width, a.height = width, height
+	a.rewrap()
+}
+
+// reload fetches the feed and post lists again, keeping the selection on the
+// same feed and post where they still exist.
+func (a *app) reload() error {
+	var selectedFeed uuid.UUID
+	if a.feedIndex > 0 && a.feedIndex < len(a.feeds) {
+		selectedFeed = a.feeds[a.feedIndex].FeedID
+	}
+
+	following, err := a.db.GetFeedFollowsForUser(context.Background(), a.user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get followed feeds: %w", err)
+	}
+
+	all := database.GetFeedFollowsForUserRow{FeedName: "All feeds"}
+	for _, feed := range following {
+		all.UnreadCount += feed.UnreadCount
+	}
+	a.feeds = append([]database.GetFeedFollowsForUserRow{all}, following...)
+
+	a.feedIndex = 0
+	for i, feed := range a.feeds {
+		if i > 0 && feed.FeedID == selectedFeed {
+			a.feedIndex = i
+		}
+	}
+
+	return a.loadPosts()
+}
+
+func (a *app) loadPosts() error {
+	var selectedPost uuid.UUID
+	if a.postIndex < len(a.posts) {
+		selectedPost = a.posts[a.postIndex].ID
+	}
+
+	params := database.BrowsePostsParams{
+		Sort:   "published",
+		UserID: a.user.ID,
+		Limit:  postLimit,
+	}
+	if a.feedIndex > 0 {
+		params.FeedID = uuid.NullUUID{UUID: a.feeds[a.feedIndex].FeedID, Valid: true}
+	}
+
+	posts, err := a.db.BrowsePosts(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("couldn't get posts: %w", err)
+	}
+	a.posts = posts
+
+	// The post being read may be gone after a refresh or a feed switch.
+	if a.readingID != uuid.Nil && a.reading() == nil {
+		a.readingID = uuid.Nil
+		a.readerTop = 0
+		if a.focus == readerPane {
+			a.focus = postsPane
+		}
+	}
+	a.rewrap()
+
+	a.postIndex = 0
+	ids := make([]uuid.UUID, 0, len(posts))
+	for i, post := range posts {
+		ids = append(ids, post.ID)
+		if post.ID == selectedPost {
+			a.postIndex = i
+		}
+	}
+
+	states, err := a.db.GetPostStates(context.Background(), database.GetPostStatesParams{
+		UserID:  a.user.ID,
+		PostIds: ids,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get post states: %w", err)
+	}
+	a.states = make(map[uuid.UUID]database.PostState, len(states))
+	for _, state := range states {
+		a.states[state.PostID] = state
+	}
+
+	return nil
+}
+
+// handleKey applies a key press, reporting whether the UI should exit.
+func (a *app) handleKey(key string) bool {
+	a.status = ""
+
+	switch key {
+	case "q", "ctrl+c":
+		return true
+	case "tab", "right", "l":
+		if a.focus < readerPane && (a.focus != postsPane || a.reading() != nil) {
+			a.focus++
+		}
+	case "backtab", "left", "h", "esc":
+		if a.focus > feedsPane {
+			a.focus--
+		}
+	case "down", "j":
+		a.move(1)
+	case "up", "k":
+		a.move(-1)
+	case "pgdown", " ":
+		a.move(a.listHeight())
+	case "pgup", "b":
+		a.move(-a.listHeight())
+	case "home", "g":
+		a.move(-1 << 30)
+	case "end", "G":
+		a.move(1 << 30)
+	case "enter":
+		switch a.focus {
+		case feedsPane:
+			a.focus = postsPane
+		case postsPane:
+			a.open()
+		}
+	case "n":
+		a.step(1)
+	case "p":
+		a.step(-1)
+	case "s":
+		a.toggleStar()
+	case "m":
+		a.toggleRead()
+	case "o":
+		a.openInBrowser()
+	case "r":
+		if err := a.reload(); err != nil {
+			a.status = err.Error()
+		} else {
+			a.status = "refreshed"
+		}
+	}
+
+	return false
+}
+
+func (a *app) move(delta int) {
+	switch a.focus {
+	case feedsPane:
+		index := clamp(a.feedIndex+delta, 0, len(a.feeds)-1)
+		if index == a.feedIndex {
+			return
+		}
+		a.feedIndex = index
+		a.postIndex, a.postTop = 0, 0
+		a.posts = nil
+		if err := a.loadPosts(); err != nil {
+			a.status = err.Error()
+		}
+	case postsPane:
+		a.postIndex = clamp(a.postIndex+delta, 0, len(a.posts)-1)
+	case readerPane:
+		a.readerTop = clamp(a.readerTop+delta, 0, len(a.readerLines)-a.listHeight())
+	}
+}
+
+// step reads the next or previous post without leaving the reader.
+func (a *app) step(delta int) {
+	index := a.postIndex + delta
+	if index < 0 || index >= len(a.posts) {
+		return
+	}
+	a.postIndex = index
+	if a.reading() != nil {
+		a.open()
+	}
+}
+
+func (a *app) selected() *database.BrowsePostsRow {
+	if a.postIndex >= len(a.posts) {
+		return nil
+	}
+	return &a.posts[a.postIndex]
+}
+
+// reading returns the post shown in the reader, if any.
+func (a *app) reading() *database.BrowsePostsRow {
+	if a.readingID == uuid.Nil {
+		return nil
+	}
+	for i := range a.posts {
+		if a.posts[i].ID == a.readingID {
+			return &a.posts[i]
+		}
+	}
+	return nil
+}
+
+// open shows the selected post in the reader and marks it read.
+func (a *app) open() {
+	post := a.selected()
+	if post == nil {
+		return
+	}
+
+	a.readingID = post.ID
+	a.readerTop = 0
+	a.focus = readerPane
+	a.rewrap()
+
+	if state := a.states[post.ID]; !state.ReadAt.Valid {
+		a.setRead(post.ID, true)
+	}
+}
+
+func (a *app) rewrap() {
+	post := a.reading()
+	if post == nil {
+		a.readerLines = nil
+		return
+	}
+
+	width := a.readerWidth() - 2
+	lines := wrap(post.Title, width)
+	a.titleLines = len(lines)
+	lines = append(lines, wrap(fmt.Sprintf("%s · %s", post.FeedName, post.PublishedAt.Time.Format("Mon Jan 2 2006 15:04")), width)...)
+	lines = append(lines, wrap(post.Url, width)...)
+	lines = append(lines, "")
+	lines = append(lines, wrap(htmltext.PlainText(post.Description.String), width)...)
+	a.readerLines = lines
+	a.readerTop = clamp(a.readerTop, 0, len(lines)-a.listHeight())
+}
+
+func (a *app) toggleStar() {
+	post := a.selected()
+	if a.focus == readerPane && a.reading() != nil {
+		post = a.reading()
+	}
+	if post == nil {
+		return
+	}
+
+	state := a.states[post.ID]
+	var err error
+	if state.StarredAt.Valid {
+		_, err = a.db.UnstarPost(context.Background(), database.UnstarPostParams{
+			UserID: a.user.ID,
+			PostID: post.ID,
+		})
+		state.StarredAt.Valid = false
+		a.status = "unstarred"
+	} else {
+		state.StarredAt.Time, state.StarredAt.Valid = time.Now().UTC(), true
+		err = a.db.StarPost(context.Background(), database.StarPostParams{
+			UserID:    a.user.ID,
+			PostID:    post.ID,
+			StarredAt: state.StarredAt,
+		})
+		a.status = "starred"
+	}
+	if err != nil {
+		a.status = fmt.Sprintf("couldn't update star: %v", err)
+		return
+	}
+
+	state.UserID, state.PostID = a.user.ID, post.ID
+	a.states[post.ID] = state
+}
+
+func (a *app) toggleRead() {
+	post := a.selected()
+	if a.focus == readerPane && a.reading() != nil {
+		post = a.reading()
+	}
+	if post == nil {
+		return
+	}
+
+	read := !a.states[post.ID].ReadAt.Valid
+	a.setRead(post.ID, read)
+	if read {
+		a.status = "marked read"
+	} else {
+		a.status = "marked unread"
+	}
+}
+
+func (a *app) setRead(postID uuid.UUID, read bool) {
+	state := a.states[postID]
+	var err error
+	if read {
+		state.ReadAt.Time, state.ReadAt.Valid = time.Now().UTC(), true
+		_, err = a.db.MarkPostsReadByID(context.Background(), database.MarkPostsReadByIDParams{
+			UserID:  a.user.ID,
+			ReadAt:  state.ReadAt.Time,
+			PostIds: []uuid.UUID{postID},
+		})
+	} else {
+		state.ReadAt.Valid = false
+		err = a.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+			UserID: a.user.ID,
+			PostID: postID,
+		})
+	}
+	if err != nil {
+		a.status = fmt.Sprintf("couldn't update read state: %v", err)
+		return
+	}
+
+	state.UserID, state.PostID = a.user.ID, postID
+	a.states[postID] = state
+
+	// keep the unread counts in the feed list honest
+	delta := int64(1)
+	if read {
+		delta = -1
+	}
+	feedID := a.postFeed(postID)
+	for i := range a.feeds {
+		if i == 0 || a.feeds[i].FeedID == feedID {
+			a.feeds[i].UnreadCount += delta
+		}
+	}
+}
+
+func (a *app) postFeed(postID uuid.UUID) uuid.UUID {
+	for _, post := range a.posts {
+		if post.ID == postID {
+			return post.FeedID
+		}
+	}
+	return uuid.Nil
+}
+
+// openInBrowser opens the selected post's link with $BROWSER, or the
+// system's default handler.
+func (a *app) openInBrowser() {
+	post := a.selected()
+	if a.focus == readerPane && a.reading() != nil {
+		post = a.reading()
+	}
+	if post == nil || post.Url == "" {
+		return
+	}
+
+	command := strings.Fields(os.Getenv("BROWSER"))
+	if len(command) == 0 {
+		switch runtime.GOOS {
+		case "darwin":
+			command = []string{"open"}
+		case "windows":
+			command = []string{"rundll32", "url.dll,FileProtocolHandler"}
+		default:
+			command = []string{"xdg-open"}
+		}
+	}
+
+	cmd := exec.Command(command[0], append(command[1:], post.Url)...)
+	if err := cmd.Start(); err != nil {
+		a.status = fmt.Sprintf("couldn't open browser: %v", err)
+		return
+	}
+	go cmd.Wait()
+	a.status = "opened " + post.Url
+}
+
+func clamp(value, low, high int) int {
+	if value > high {
+		value = high
+	}
+	if value < low {
+		value = low
+	}
+	return value
+}
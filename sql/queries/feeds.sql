@@ -11,21 +11,122 @@ VALUES (
 RETURNING *;
 
 -- name: GetFeeds :many
-SELECT feeds.name feedname, feeds.url, users.name createdby
+SELECT feeds.name feedname, feeds.url, users.name createdby,
+    feeds.last_fetched_at, feeds.last_succeeded_at, feeds.consecutive_failures, feeds.last_error,
+    feeds.disabled_at, feeds.disabled_reason,
+    feeds.refresh_interval_seconds, feeds.auto_interval_seconds, feeds.next_fetch_at
 FROM feeds
 JOIN users ON feeds.user_id = users.id;
 
 -- name: GetFeedByURL :one
 SELECT * FROM feeds
-where url = $1;
+WHERE url = $1
+   OR id = (SELECT feed_id FROM feed_url_history WHERE feed_url_history.url = $1)
+ORDER BY url = $1 DESC
+LIMIT 1;
 
--- name: MarkFeedFetched :one
+-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = NOW(), last_fetched_at = NOW()
-WHERE id = $1
-RETURNING *;
+SET updated_at = NOW(), last_fetched_at = NOW(), last_succeeded_at = NOW(),
+    consecutive_failures = 0, last_error = NULL,
+    claimed_by = NULL, claimed_until = NULL,
+    auto_interval_seconds = COALESCE(sqlc.narg(auto_interval_seconds), auto_interval_seconds),
+    next_fetch_at = NOW() + COALESCE(
+        refresh_interval_seconds,
+        sqlc.narg(auto_interval_seconds),
+        auto_interval_seconds,
+        sqlc.arg(default_interval_seconds)::int
+    ) * INTERVAL '1 second'
+WHERE id = sqlc.arg(id);
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+-- name: MarkFeedFetchFailed :exec
+UPDATE feeds
+SET updated_at = NOW(), last_fetched_at = NOW(),
+    consecutive_failures = consecutive_failures + 1, last_error = $2,
+    claimed_by = NULL, claimed_until = NULL,
+    next_fetch_at = NOW() + LEAST(POWER(2, consecutive_failures + 1), 1440) * INTERVAL '1 minute'
+WHERE id = $1;
+
+-- name: ClaimFeedsToFetch :many
+WITH claimed AS (
+    UPDATE feeds
+    SET claimed_by = sqlc.arg(claimed_by),
+        claimed_until = NOW() + sqlc.arg(lease_seconds)::int * INTERVAL '1 second'
+    WHERE id IN (
+        SELECT id FROM feeds
+        WHERE disabled_at IS NULL
+          AND (claimed_until IS NULL OR claimed_until < NOW())
+          AND (retry_after IS NULL OR retry_after <= NOW())
+          AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+        LIMIT sqlc.arg(batch_size)
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *
+)
+SELECT * FROM claimed
+ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST;
+
+-- name: RenewFeedClaim :execrows
+-- Extends this process's claim on a feed just before it is fetched. No row is
+-- updated if the claim lapsed and another process has taken the feed since.
+UPDATE feeds
+SET claimed_until = NOW() + sqlc.arg(lease_seconds)::int * INTERVAL '1 second'
+WHERE id = sqlc.arg(id) AND claimed_by = sqlc.arg(claimed_by);
+
+-- name: ReleaseFeedClaims :exec
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND claimed_by = sqlc.arg(claimed_by);
+
+-- name: DeferFeedClaims :exec
+-- Releases feeds whose host is cooling down and moves their next fetch to
+-- when the host is ready, so they don't keep the head of ClaimFeedsToFetch
+-- from reaching feeds on other hosts.
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL,
+    next_fetch_at = NOW() + deferred.delay_ms * INTERVAL '1 millisecond'
+FROM unnest(sqlc.arg(ids)::uuid[], sqlc.arg(delays_ms)::int[]) AS deferred(id, delay_ms)
+WHERE feeds.id = deferred.id AND feeds.claimed_by = sqlc.arg(claimed_by);
+
+-- name: SetFeedRetryAfter :exec
+UPDATE feeds
+SET retry_after = NOW() + sqlc.arg(retry_after_seconds)::int * INTERVAL '1 second'
+WHERE id = sqlc.arg(id);
+
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3
+WHERE id = $1;
+
+-- name: UpdateFeedURL :exec
+WITH moved AS (
+    INSERT INTO feed_url_history (id, created_at, feed_id, url)
+    SELECT gen_random_uuid(), NOW(), feeds.id, feeds.url
+    FROM feeds
+    WHERE feeds.id = sqlc.arg(id)
+    ON CONFLICT (url) DO NOTHING
+)
+UPDATE feeds
+SET url = sqlc.arg(url), updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: DisableFeed :exec
+UPDATE feeds
+SET disabled_at = NOW(), disabled_reason = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled_at = NULL, disabled_reason = NULL, retry_after = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetFeedRefreshInterval :exec
+UPDATE feeds
+SET refresh_interval_seconds = $2, next_fetch_at = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_posts = $2, retention_days = $3, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,72 @@
+-- name: MarkPostsReadByID :execrows
+INSERT INTO post_states (user_id, post_id, read_at)
+SELECT sqlc.arg(user_id)::uuid, post_id, sqlc.arg(read_at)::timestamp
+FROM unnest(sqlc.arg(post_ids)::uuid[]) AS post_id
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read_at = EXCLUDED.read_at
+WHERE post_states.read_at IS NULL;
+
+-- name: MarkPostsRead :execrows
+INSERT INTO post_states (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(read_at)::timestamp
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+  AND (sqlc.narg(before)::timestamp IS NULL OR posts.published_at < sqlc.narg(before)::timestamp)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read_at = EXCLUDED.read_at
+WHERE post_states.read_at IS NULL;
+
+-- name: StarPost :exec
+INSERT INTO post_states (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred_at = COALESCE(post_states.starred_at, EXCLUDED.starred_at);
+
+-- name: UnstarPost :execrows
+UPDATE post_states
+SET starred_at = NULL
+WHERE user_id = $1 AND post_id = $2 AND starred_at IS NOT NULL;
+
+-- name: GetStarredPosts :many
+SELECT posts.*, feeds.name AS feed_name FROM posts
+JOIN post_states ON post_states.post_id = posts.id
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_states.user_id = $1 AND post_states.starred_at IS NOT NULL
+ORDER BY post_states.starred_at DESC;
+
+-- name: GetQueuedPosts :many
+SELECT posts.*, feeds.name AS feed_name FROM posts
+JOIN post_states ON post_states.post_id = posts.id
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_states.user_id = $1 AND post_states.queue_position IS NOT NULL
+ORDER BY post_states.queue_position ASC;
+
+-- name: GetQueuePosition :one
+SELECT queue_position FROM post_states
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: CountQueuedPosts :one
+SELECT COUNT(*) FROM post_states
+WHERE user_id = $1 AND queue_position IS NOT NULL;
+
+-- name: SetQueuePosition :exec
+INSERT INTO post_states (user_id, post_id, queue_position)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET queue_position = EXCLUDED.queue_position;
+
+-- name: ShiftQueue :exec
+UPDATE post_states
+SET queue_position = queue_position + sqlc.arg(delta)::int
+WHERE user_id = sqlc.arg(user_id) AND queue_position >= sqlc.arg(from_position)::int;
+
+-- name: GetPostStates :many
+SELECT * FROM post_states
+WHERE user_id = sqlc.arg(user_id) AND post_id = ANY(sqlc.arg(post_ids)::uuid[]);
+
+-- name: MarkPostUnread :exec
+UPDATE post_states
+SET read_at = NULL
+WHERE user_id = $1 AND post_id = $2;
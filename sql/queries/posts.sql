@@ -1,21 +1,191 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
+-- name: UpsertPosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source, guid, content_hash, description_text)
+SELECT gen_random_uuid(), sqlc.arg(fetched_at)::timestamp, sqlc.arg(fetched_at)::timestamp,
+    item.title, item.url, item.description, item.published_at, sqlc.arg(feed_id)::uuid,
+    item.published_at_source, item.guid, item.content_hash, item.description_text
+FROM unnest(
+    sqlc.arg(titles)::text[],
+    sqlc.arg(urls)::text[],
+    sqlc.arg(descriptions)::text[],
+    sqlc.arg(published_ats)::timestamp[],
+    sqlc.arg(published_at_sources)::text[],
+    sqlc.arg(guids)::text[],
+    sqlc.arg(content_hashes)::text[],
+    sqlc.arg(description_texts)::text[]
+) AS item(title, url, description, published_at, published_at_source, guid, content_hash, description_text)
+WHERE NOT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE pruned_posts.feed_id = sqlc.arg(feed_id)::uuid AND pruned_posts.guid = item.guid
 )
-RETURNING *;
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    description_text = EXCLUDED.description_text,
+    published_at = CASE WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at ELSE posts.published_at END,
+    published_at_source = CASE WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at_source ELSE posts.published_at_source END,
+    content_hash = EXCLUDED.content_hash
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING guid, (xmax = 0) AS inserted;
 
--- name: GetPostsForUser :many
+-- name: AdoptLegacyPosts :execrows
+-- Posts stored before guids were tracked were given their url as guid. When
+-- an item with a different guid links to such a post, the post takes the
+-- item's guid instead of the item being stored a second time.
+UPDATE posts
+SET guid = item.guid
+FROM unnest(sqlc.arg(urls)::text[], sqlc.arg(guids)::text[]) AS item(url, guid)
+WHERE posts.feed_id = sqlc.arg(feed_id)
+  AND posts.url = item.url
+  AND posts.guid = posts.url
+  AND item.guid <> item.url
+  AND NOT EXISTS (
+    SELECT 1 FROM posts existing
+    WHERE existing.feed_id = posts.feed_id AND existing.guid = item.guid
+  );
+
+-- name: CreatePostRevisions :execrows
+INSERT INTO post_revisions (id, created_at, post_id, title, url, description, content_hash)
+SELECT gen_random_uuid(), sqlc.arg(created_at)::timestamp, posts.id, posts.title, posts.url, posts.description, posts.content_hash
+FROM posts
+JOIN unnest(sqlc.arg(guids)::text[], sqlc.arg(content_hashes)::text[]) AS item(guid, content_hash)
+    ON posts.guid = item.guid
+WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.content_hash <> item.content_hash;
+
+-- name: BrowsePosts :many
+-- Posts are ordered by (sort_name, sort_time, id). sort_name is the feed name
+-- when sorting by feed and empty otherwise, and sort_time is negated for the
+-- default newest first order, so that a single keyset comparison against the
+-- cursor post works for every sort.
+WITH after_post AS (
+    SELECT posts.id,
+        CASE WHEN sqlc.arg(sort)::text = 'feed' THEN feeds.name ELSE '' END AS sort_name,
+        EXTRACT(EPOCH FROM CASE WHEN sqlc.arg(sort)::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END)
+            * CASE WHEN sqlc.arg(reverse)::bool THEN 1 ELSE -1 END AS sort_time
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    WHERE posts.id = sqlc.narg(after)::uuid
+),
+keyed AS (
+    SELECT posts.*, feeds.name AS feed_name,
+        CASE WHEN sqlc.arg(sort)::text = 'feed' THEN feeds.name ELSE '' END AS sort_name,
+        EXTRACT(EPOCH FROM CASE WHEN sqlc.arg(sort)::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END)
+            * CASE WHEN sqlc.arg(reverse)::bool THEN 1 ELSE -1 END AS sort_time
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+    LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+    WHERE feed_follows.user_id = sqlc.arg(user_id)
+      AND (NOT sqlc.arg(unread_only)::bool OR post_states.read_at IS NULL)
+      AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+      AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+      AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+)
+SELECT keyed.id, keyed.created_at, keyed.updated_at, keyed.title, keyed.url, keyed.description, keyed.published_at, keyed.feed_id, keyed.published_at_source, keyed.guid, keyed.content_hash, keyed.description_text, keyed.feed_name
+FROM keyed
+LEFT JOIN after_post ON TRUE
+WHERE sqlc.narg(after)::uuid IS NULL
+   OR (NOT sqlc.arg(reverse)::bool AND keyed.sort_name > after_post.sort_name)
+   OR (sqlc.arg(reverse)::bool AND keyed.sort_name < after_post.sort_name)
+   OR (keyed.sort_name = after_post.sort_name AND (keyed.sort_time, keyed.id) > (after_post.sort_time, after_post.id))
+ORDER BY
+    CASE WHEN sqlc.arg(reverse)::bool THEN keyed.sort_name END DESC,
+    CASE WHEN NOT sqlc.arg(reverse)::bool THEN keyed.sort_name END ASC,
+    keyed.sort_time ASC,
+    keyed.id ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetNewPostsForUser :many
+-- Takes the same filters as BrowsePosts, so following a listing keeps to it.
 SELECT posts.*, feeds.name AS feed_name FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id) AND posts.created_at > sqlc.arg(created_at)
+  AND (NOT sqlc.arg(unread_only)::bool OR post_states.read_at IS NULL)
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+ORDER BY posts.created_at ASC;
+
+-- name: GetLatestPostCreatedAt :one
+SELECT COALESCE(MAX(created_at), 'epoch'::timestamp)::timestamp AS latest FROM posts;
+
+-- name: NotifyNewPosts :exec
+SELECT pg_notify('gator_new_posts', sqlc.arg(feed_id)::uuid::text);
+
+-- name: PrunePosts :many
+-- Pruned posts leave a tombstone behind, which keeps UpsertPosts from storing
+-- them again while the feed still lists them.
+WITH ranked AS (
+    SELECT posts.id,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position,
+        COALESCE(posts.published_at, posts.created_at) AS dated_at,
+        COALESCE(feeds.retention_posts, sqlc.arg(default_posts)::int) AS keep_posts,
+        COALESCE(feeds.retention_days, sqlc.arg(default_days)::int) AS keep_days
+    FROM posts
+    JOIN feeds ON feeds.id = posts.feed_id
+    -- starred and queued posts are kept whatever the policy says
+    WHERE NOT EXISTS (
+        SELECT 1 FROM post_states
+        WHERE post_states.post_id = posts.id
+          AND (post_states.starred_at IS NOT NULL OR post_states.queue_position IS NOT NULL)
+    )
+),
+pruned AS (
+    DELETE FROM posts
+    USING ranked, feeds
+    WHERE posts.id = ranked.id AND feeds.id = posts.feed_id
+      AND (
+        (ranked.keep_posts > 0 AND ranked.position > ranked.keep_posts)
+        OR (ranked.keep_days > 0 AND ranked.dated_at < (NOW() AT TIME ZONE 'UTC') - ranked.keep_days * INTERVAL '1 day')
+      )
+    RETURNING posts.feed_id, posts.guid, feeds.name
+),
+tombstones AS (
+    INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+    SELECT feed_id, guid, NOW() AT TIME ZONE 'UTC' FROM pruned
+    ON CONFLICT DO NOTHING
+)
+SELECT name FROM pruned;
+
+-- name: ForgetPrunedPosts :exec
+-- Drops the tombstones of pruned posts their feed no longer lists.
+DELETE FROM pruned_posts
+WHERE feed_id = sqlc.arg(feed_id) AND NOT (guid = ANY(sqlc.arg(guids)::text[]));
+
+-- name: GetPostIDsInRange :many
+-- The ids sharing a prefix form a range, which the primary key can look up.
+SELECT id FROM posts
+WHERE id BETWEEN sqlc.arg(low)::uuid AND sqlc.arg(high)::uuid
+ORDER BY id
+LIMIT 2;
+
+-- name: SearchPosts :many
+SELECT posts.id, posts.url, posts.published_at, feeds.name AS feed_name,
+    ts_rank_cd(
+        setweight(to_tsvector('english', posts.title), 'A') ||
+        setweight(to_tsvector('english', COALESCE(posts.description_text, '')), 'B'),
+        query
+    ) AS rank,
+    ts_headline('english', posts.title, query, sqlc.arg(headline_options)::text) AS title,
+    ts_headline('english', COALESCE(posts.description_text, ''), query, sqlc.arg(headline_options)::text) AS snippet
+FROM posts
+JOIN feeds ON feeds.id = posts.feed_id,
+    to_tsquery('english', sqlc.arg(query)::text) AS query
+WHERE (
+        setweight(to_tsvector('english', posts.title), 'A') ||
+        setweight(to_tsvector('english', COALESCE(posts.description_text, '')), 'B')
+    ) @@ query
+  AND (NOT sqlc.arg(followed_only)::bool OR posts.feed_id IN (
+        SELECT feed_follows.feed_id FROM feed_follows WHERE feed_follows.user_id = sqlc.arg(user_id)
+    ))
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(before)::timestamp IS NULL OR posts.published_at < sqlc.narg(before)::timestamp)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
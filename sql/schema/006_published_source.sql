@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN published_at_source TEXT;
+
+UPDATE posts
+SET published_at_source = 'item'
+WHERE published_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN published_at_source;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN retry_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN retry_after;
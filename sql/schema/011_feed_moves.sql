@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE feed_url_history (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    url TEXT UNIQUE NOT NULL
+);
+
+ALTER TABLE feeds
+ADD COLUMN disabled_at TIMESTAMP,
+ADD COLUMN disabled_reason TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN disabled_at,
+DROP COLUMN disabled_reason;
+
+DROP TABLE feed_url_history;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN last_succeeded_at TIMESTAMP,
+ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT;
+
+UPDATE feeds
+SET last_succeeded_at = last_fetched_at;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_succeeded_at,
+DROP COLUMN consecutive_failures,
+DROP COLUMN last_error;
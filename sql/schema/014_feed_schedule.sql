@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN refresh_interval_seconds INTEGER,
+ADD COLUMN auto_interval_seconds INTEGER,
+ADD COLUMN next_fetch_at TIMESTAMP;
+
+UPDATE feeds
+SET next_fetch_at = last_fetched_at + LEAST(POWER(2, consecutive_failures), 1440) * INTERVAL '1 minute'
+WHERE consecutive_failures > 0;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN refresh_interval_seconds,
+DROP COLUMN auto_interval_seconds,
+DROP COLUMN next_fetch_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE post_states
+ADD COLUMN starred_at TIMESTAMP,
+ADD COLUMN queue_position INTEGER;
+
+CREATE INDEX post_states_kept_idx ON post_states (post_id)
+WHERE starred_at IS NOT NULL OR queue_position IS NOT NULL;
+
+-- +goose Down
+DROP INDEX post_states_kept_idx;
+
+ALTER TABLE post_states
+DROP COLUMN starred_at,
+DROP COLUMN queue_position;
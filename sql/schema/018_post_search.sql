@@ -0,0 +1,10 @@
+-- +goose Up
+-- The expression must match the one used by SearchPosts for the index to
+-- be used.
+CREATE INDEX posts_search_idx ON posts USING GIN ((
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+));
+
+-- +goose Down
+DROP INDEX posts_search_idx;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Pruned posts are remembered for as long as their feed still lists them,
+-- so the aggregator doesn't store them again as new.
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- +goose Down
+DROP TABLE pruned_posts;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Descriptions are HTML, search works on a plain text copy so snippets
+-- don't contain markup. The aggregator fills it in for new and updated
+-- posts. Existing posts get a rough version here, with tags dropped and the
+-- most common entities decoded.
+ALTER TABLE posts
+ADD COLUMN description_text TEXT;
+
+UPDATE posts
+SET description_text = btrim(regexp_replace(
+    replace(replace(replace(replace(replace(replace(
+        regexp_replace(description, '<[^>]*>', ' ', 'g'),
+        '&nbsp;', ' '), '&quot;', '"'), '&#39;', ''''), '&lt;', '<'), '&gt;', '>'), '&amp;', '&'),
+    '\s+', ' ', 'g'))
+WHERE description IS NOT NULL;
+
+DROP INDEX posts_search_idx;
+
+-- The expression must match the one used by SearchPosts for the index to
+-- be used.
+CREATE INDEX posts_search_idx ON posts USING GIN ((
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description_text, '')), 'B')
+));
+
+-- +goose Down
+DROP INDEX posts_search_idx;
+
+CREATE INDEX posts_search_idx ON posts USING GIN ((
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+));
+
+ALTER TABLE posts
+DROP COLUMN description_text;
@@ -0,0 +1,8 @@
+// Package schema holds gator's database migrations, embedded so the binary
+// can apply them itself. See the migrate command.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS